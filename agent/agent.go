@@ -0,0 +1,192 @@
+// Package agent implements a client and server for holding a socketguard
+// static private key in a separate process.
+//
+// The server listens on a unix socket and answers fixed size requests:
+//
+//	request:  u8 op (1: public key, 2: DH) | [32]byte peer public key
+//	response: u8 status (0: ok, 1: low order point, 2: failure) | [32]byte key
+//
+// A Client implements socketguard.StaticKey, so a Config can use the agent
+// in place of a StaticPrivate key.
+package agent
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+const (
+	opPublic = 1
+	opDH     = 2
+
+	statusOK       = 0
+	statusLowOrder = 1
+	statusFailure  = 2
+
+	requestSize  = 1 + noise.KeySize
+	responseSize = 1 + noise.KeySize
+
+	timeout = 5 * time.Second
+)
+
+var ErrAgentFailure = errors.New("socketguard: agent failure")
+
+type Client struct {
+	addr string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	public noise.Key
+}
+
+func Dial(path string) (*Client, error) {
+	c := &Client{addr: path}
+
+	pub, err := c.roundTrip(opPublic, noise.Key{})
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.public = pub
+	return c, nil
+}
+
+func (c *Client) Public() noise.Key {
+	return c.public
+}
+
+func (c *Client) DH(peer noise.Key) (noise.Key, error) {
+	return c.roundTrip(opDH, peer)
+}
+
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+func (c *Client) roundTrip(op byte, key noise.Key) (noise.Key, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// a cached connection may have been closed by a restarted agent, so
+	// retry once on a fresh connection
+	reused := c.conn != nil
+
+	res, err := c.exchange(op, key)
+	if err != nil && reused {
+		res, err = c.exchange(op, key)
+	}
+	return res, err
+}
+
+func (c *Client) exchange(op byte, key noise.Key) (noise.Key, error) {
+	var res noise.Key
+
+	if c.conn == nil {
+		conn, err := net.DialTimeout("unix", c.addr, timeout)
+		if err != nil {
+			return res, err
+		}
+		c.conn = conn
+	}
+
+	var buf [responseSize]byte
+	defer zero(buf[:])
+
+	buf[0] = op
+	copy(buf[1:], key[:])
+
+	c.conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := c.conn.Write(buf[:requestSize]); err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return res, err
+	}
+	if _, err := io.ReadFull(c.conn, buf[:]); err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return res, err
+	}
+
+	switch buf[0] {
+	case statusOK:
+		copy(res[:], buf[1:])
+		return res, nil
+	case statusLowOrder:
+		return res, noise.ErrLowOrderPoint
+	default:
+		return res, ErrAgentFailure
+	}
+}
+
+func Serve(ln net.Listener, key noise.PrivateKey) error {
+	pub := key.Public()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+
+		go serveConn(conn, key, pub)
+	}
+}
+
+func serveConn(conn net.Conn, key noise.PrivateKey, pub noise.Key) {
+	defer conn.Close()
+
+	var (
+		req  [requestSize]byte
+		res  [responseSize]byte
+		peer noise.Key
+	)
+	defer zero(res[:])
+
+	for {
+		if _, err := io.ReadFull(conn, req[:]); err != nil {
+			return
+		}
+		copy(peer[:], req[1:])
+
+		res = [responseSize]byte{}
+		switch req[0] {
+		case opPublic:
+			copy(res[1:], pub[:])
+		case opDH:
+			ss, err := key.DH(peer)
+			switch err {
+			case nil:
+				copy(res[1:], ss[:])
+			case noise.ErrLowOrderPoint:
+				res[0] = statusLowOrder
+			default:
+				res[0] = statusFailure
+			}
+		default:
+			res[0] = statusFailure
+		}
+
+		if _, err := conn.Write(res[:]); err != nil {
+			return
+		}
+	}
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/benburkert/socketguard-go"
+	"github.com/benburkert/socketguard-go/internal/must"
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+func TestAgent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "agent.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	srvPriv, srvPub := must.GenerateKeyPair()
+	go Serve(ln, noise.PrivateKey(srvPriv))
+
+	agent, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+
+	if want, got := srvPub, agent.Public(); want != got {
+		t.Errorf("want public key %s, got %s", want, got)
+	}
+
+	_, peer := must.GenerateKeyPair()
+	want, err := noise.PrivateKey(srvPriv).DH(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := agent.DH(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want != got {
+		t.Errorf("want shared secret %x, got %x", want[:], got[:])
+	}
+
+	if _, err := agent.DH(must.LowOrderPoints[0]); err != noise.ErrLowOrderPoint {
+		t.Errorf("want error %v, got %v", noise.ErrLowOrderPoint, err)
+	}
+
+	agent.conn.Close() // simulate an agent restart
+	if _, err := agent.DH(peer); err != nil {
+		t.Errorf("want reconnect after closed connection, got %v", err)
+	}
+
+	cliPriv, cliPub := must.GenerateKeyPair()
+	cliConf := &socketguard.Config{
+		StaticPrivate: cliPriv,
+		PeerPublic:    srvPub,
+	}
+	srvConf := &socketguard.Config{
+		StaticKey: agent,
+		PreferGo:  true,
+	}
+	if err := srvConf.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	cliNet, srvNet := net.Pipe()
+	cli, srv := socketguard.Client(cliNet, cliConf), socketguard.Server(srvNet, srvConf)
+	defer cli.Close()
+	defer srv.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := cli.Write([]byte("ping!"))
+		errc <- err
+	}()
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(srv, buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "ping!", string(buf); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if want, got := cliPub, srv.ConnectionState().PeerPublic; want != got {
+		t.Errorf("want peer public %s, got %s", want, got)
+	}
+}
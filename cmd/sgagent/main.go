@@ -0,0 +1,106 @@
+//go:build !windows
+// +build !windows
+
+// Command sgagent holds a socketguard static private key and performs key
+// operations for other processes over a unix socket, so that services never
+// load the private key themselves:
+//
+//	sgagent -key private.key -socket /run/sgagent.sock
+//
+// Encrypted key files are decrypted with the passphrase from the file named
+// by -passphrase-file or the SGAGENT_PASSPHRASE environment variable.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/benburkert/socketguard-go/agent"
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+const passphraseEnv = "SGAGENT_PASSPHRASE"
+
+var (
+	keyFile  = flag.String("key", "", "private key file")
+	passFile = flag.String("passphrase-file", "", "passphrase file for an encrypted private key")
+	socket   = flag.String("socket", "", "unix socket path")
+)
+
+func main() {
+	flag.Parse()
+
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "sgagent: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if *keyFile == "" {
+		return fmt.Errorf("-key required")
+	}
+	if *socket == "" {
+		return fmt.Errorf("-socket required")
+	}
+
+	key, err := loadKey()
+	if err != nil {
+		return err
+	}
+
+	if fi, err := os.Lstat(*socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", *socket); err == nil {
+			conn.Close()
+			return fmt.Errorf("%s: agent already running", *socket)
+		}
+		os.Remove(*socket)
+	}
+
+	mask := syscall.Umask(0177)
+	ln, err := net.Listen("unix", *socket)
+	syscall.Umask(mask)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigc
+		cancel()
+		ln.Close()
+	}()
+
+	log.Printf("serving public key %s on %s", key.Public(), *socket)
+	if err := agent.Serve(ln, key); ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+func loadKey() (noise.PrivateKey, error) {
+	var pass noise.Passphrase
+	if *passFile != "" {
+		pass = noise.PassphraseFile(*passFile)
+	} else if _, ok := os.LookupEnv(passphraseEnv); ok {
+		pass = noise.PassphraseEnv(passphraseEnv)
+	}
+
+	if pass == nil {
+		key, err := noise.LoadKeyFile(*keyFile)
+		return noise.PrivateKey(key), err
+	}
+
+	key, err := noise.DecryptKeyFile(*keyFile, pass)
+	return noise.PrivateKey(key), err
+}
@@ -0,0 +1,174 @@
+// Command sgcat copies stdin and stdout over a socketguard connection.
+//
+//	sgcat [flags] host:port       dial a socketguard peer
+//	sgcat -l [flags] [host]:port  accept a single socketguard connection
+//
+// The private key is read from -key, or kept in an sgagent process reached
+// through -agent.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+
+	"github.com/benburkert/socketguard-go"
+	"github.com/benburkert/socketguard-go/agent"
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+var (
+	listen    = flag.Bool("l", false, "listen for an incoming connection")
+	keyFile   = flag.String("key", "", "private key file")
+	agentSock = flag.String("agent", "", "sgagent socket holding the private key")
+	peerKey   = flag.String("peer", "", "peer public key or public key file")
+	pskFile   = flag.String("psk", "", "preshared key file")
+	kernel    = flag.Bool("kernel", false, "use the socketguard kernel module")
+	optName   = flag.Uint("optname", 0, "socketguard kernel module socket option level")
+	halfClose = flag.Bool("half-close", false, "shut down the write side on stdin EOF")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sgcat [flags] host:port\n       sgcat -l [flags] [host]:port\n\nflags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(context.Background(), flag.Arg(0)); err != nil {
+		fmt.Fprintf(os.Stderr, "sgcat: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, addr string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	var conn net.Conn
+	if *listen {
+		ln, err := socketguard.Listen(ctx, "tcp", addr, config)
+		if err != nil {
+			return err
+		}
+
+		conn, err = ln.Accept()
+		ln.Close()
+		if err != nil {
+			return err
+		}
+
+		// fail on an unauthorized peer before copying any input
+		if sc, ok := conn.(*socketguard.Conn); ok {
+			if err := sc.Handshake(); err != nil {
+				conn.Close()
+				return err
+			}
+		}
+	} else {
+		if conn, err = socketguard.Dial(ctx, "tcp", addr, config); err != nil {
+			return err
+		}
+	}
+	defer conn.Close()
+
+	return pipe(conn, os.Stdin, os.Stdout)
+}
+
+func loadConfig() (*socketguard.Config, error) {
+	config := &socketguard.Config{
+		OptName:  uintptr(*optName),
+		PreferGo: !*kernel,
+	}
+
+	var err error
+	switch {
+	case *agentSock != "":
+		if config.StaticKey, err = agent.Dial(*agentSock); err != nil {
+			return nil, err
+		}
+	case *keyFile != "":
+		if config.StaticPrivate, err = noise.LoadKeyFile(*keyFile); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("-key or -agent required")
+	}
+
+	if *peerKey != "" {
+		if config.PeerPublic, err = parsePeerKey(*peerKey); err != nil {
+			return nil, err
+		}
+
+		// a Go server learns the peer from the handshake, so only a
+		// registry restricts which client it accepts
+		if *listen && config.PreferGo {
+			if config.Peers, err = socketguard.NewPeerRegistry(&socketguard.Peer{PublicKey: config.PeerPublic}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if *pskFile != "" {
+		if config.PresharedKey, err = noise.LoadKeyFile(*pskFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return config, config.Validate()
+}
+
+func parsePeerKey(s string) (noise.Key, error) {
+	if key, err := noise.ParseKey(s); err == nil {
+		return key, nil
+	}
+
+	buf, err := ioutil.ReadFile(s)
+	if err != nil {
+		return noise.Key{}, fmt.Errorf("-peer: %w", err)
+	}
+	return noise.ParseKey(string(buf))
+}
+
+func pipe(conn net.Conn, stdin io.Reader, stdout io.Writer) error {
+	errc := make(chan error, 2)
+
+	go func() {
+		_, err := io.Copy(stdout, conn)
+		errc <- err
+	}()
+
+	go func() {
+		if _, err := io.Copy(conn, stdin); err != nil {
+			errc <- err
+			return
+		}
+
+		if !*halfClose {
+			return
+		}
+
+		cw, ok := conn.(interface{ CloseWrite() error })
+		if !ok {
+			errc <- fmt.Errorf("half-close unsupported by %T", conn)
+			return
+		}
+		if err := cw.CloseWrite(); err != nil {
+			errc <- err
+		}
+	}()
+
+	return <-errc
+}
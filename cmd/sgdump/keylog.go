@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+const (
+	labelInitiator = "SOCKETGUARD_INITIATOR_KEY"
+	labelResponder = "SOCKETGUARD_RESPONDER_KEY"
+)
+
+type keyLog map[noise.Key]map[string]noise.Key
+
+func parseKeyLog(r io.Reader) (keyLog, error) {
+	kl := make(keyLog)
+
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("key log line %d: want 4 fields, got %d", lineno, len(fields))
+		}
+
+		label := fields[0]
+		if label != labelInitiator && label != labelResponder {
+			return nil, fmt.Errorf("key log line %d: unknown label %q", lineno, label)
+		}
+
+		var eph, key noise.Key
+		if err := decodeHexKey(eph[:], fields[2]); err != nil {
+			return nil, fmt.Errorf("key log line %d: ephemeral: %w", lineno, err)
+		}
+		if err := decodeHexKey(key[:], fields[3]); err != nil {
+			return nil, fmt.Errorf("key log line %d: key: %w", lineno, err)
+		}
+
+		if kl[eph] == nil {
+			kl[eph] = make(map[string]noise.Key)
+		}
+		kl[eph][label] = key
+	}
+	return kl, scanner.Err()
+}
+
+func (kl keyLog) lookup(eph noise.Key, label string) *noise.SymmetricKey {
+	keys := kl[eph]
+	if keys == nil {
+		return nil
+	}
+
+	key, ok := keys[label]
+	if !ok && label == "" && len(keys) == 1 {
+		for _, key = range keys {
+			ok = true
+		}
+	}
+	if !ok {
+		return nil
+	}
+	return &noise.SymmetricKey{Key: key}
+}
+
+func decodeHexKey(dst []byte, s string) error {
+	if hex.DecodedLen(len(s)) != len(dst) {
+		return noise.ErrInvalidKey
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
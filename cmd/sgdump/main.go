@@ -0,0 +1,266 @@
+// Command sgdump prints the socketguard messages found in a pcap file.
+//
+//	sgdump [-keylog file] [-x] capture.pcap
+//
+// TCP streams are reassembled and every stream that starts with a
+// socketguard message header is decoded. Given a key log written by
+// Config.KeyLogWriter, Data payloads are decrypted, following rekeys.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/benburkert/socketguard-go/message"
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+var le = binary.LittleEndian
+
+var (
+	keyLogFile = flag.String("keylog", "", "key log file for decrypting Data messages")
+	hexDump    = flag.Bool("x", false, "print a hex dump of decrypted payloads")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sgdump [flags] capture.pcap\n\nflags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), *keyLogFile, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "sgdump: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(pcapFile, keyLogFile string, w io.Writer) error {
+	var kl keyLog
+	if keyLogFile != "" {
+		f, err := os.Open(keyLogFile)
+		if err != nil {
+			return err
+		}
+		kl, err = parseKeyLog(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(pcapFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	streams, err := readStreams(f)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]flowKey, 0, len(streams))
+	for key, s := range streams {
+		s.decrypt(kl, streams)
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+
+	var records []record
+	for _, key := range keys {
+		records = append(records, streams[key].records...)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].ts.Before(records[j].ts)
+	})
+
+	for _, rec := range records {
+		rec.print(w)
+	}
+	return nil
+}
+
+type flow struct {
+	*stream
+
+	records []record
+}
+
+type record struct {
+	ts   time.Time
+	flow flowKey
+	msg  message.Message
+
+	plaintext []byte
+	err       error
+}
+
+func readStreams(r io.Reader) (map[flowKey]*flow, error) {
+	pr, err := newPcapReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	streams := make(map[flowKey]*stream)
+	for {
+		ts, pkt, err := pr.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		key, seg, ok := parsePacket(pr.linkType, pkt)
+		if !ok {
+			continue
+		}
+		seg.ts = ts
+
+		s, ok := streams[key]
+		if !ok {
+			s = newStream(key, ts)
+			streams[key] = s
+		}
+		s.add(seg)
+	}
+
+	flows := make(map[flowKey]*flow)
+	for key, s := range streams {
+		if f := decodeStream(s); f != nil {
+			flows[key] = f
+		}
+	}
+	return flows, nil
+}
+
+func decodeStream(s *stream) *flow {
+	var (
+		cr  = &countingReader{r: bytes.NewReader(s.buf)}
+		dec = message.NewDecoder(cr)
+		f   = &flow{stream: s}
+	)
+
+	for {
+		// the decoder trusts the length in the header, so stop at a
+		// truncated or bogus message instead of allocating for it.
+		rest := s.buf[cr.n:]
+		if len(rest) < 8 || uint64(len(rest)-8) < uint64(le.Uint32(rest[4:])) {
+			break
+		}
+
+		msg, err := dec.Decode()
+		if err != nil {
+			break
+		}
+		if d, ok := msg.(*message.Data); ok {
+			// the decoder reuses Data messages and their buffers
+			msg = &message.Data{
+				EncryptedData: append([]byte(nil), d.EncryptedData...),
+			}
+		}
+
+		f.records = append(f.records, record{
+			ts:   s.timeAt(cr.n),
+			flow: s.key,
+			msg:  msg,
+		})
+	}
+
+	if len(f.records) == 0 {
+		return nil
+	}
+	return f
+}
+
+func (f *flow) decrypt(kl keyLog, flows map[flowKey]*flow) {
+	if kl == nil {
+		return
+	}
+
+	var key *noise.SymmetricKey
+	for i := range f.records {
+		rec := &f.records[i]
+
+		switch msg := rec.msg.(type) {
+		case *message.HandshakeInitiation:
+			key = kl.lookup(msg.UnencryptedEphemeral, labelInitiator)
+		case *message.HandshakeResponse:
+			if peer, ok := flows[f.key.reverse()]; ok {
+				if hi, ok := peer.initiation(); ok {
+					key = kl.lookup(hi.UnencryptedEphemeral, labelResponder)
+				}
+			}
+		case *message.HandshakeRekey:
+			key = kl.lookup(msg.UnencryptedEphemeral, "")
+		case *message.Data:
+			if key == nil {
+				rec.err = errors.New("no key")
+				continue
+			}
+			rec.plaintext, rec.err = key.Open(nil, msg.EncryptedData)
+		}
+	}
+}
+
+func (f *flow) initiation() (*message.HandshakeInitiation, bool) {
+	for _, rec := range f.records {
+		if hi, ok := rec.msg.(*message.HandshakeInitiation); ok {
+			return hi, true
+		}
+	}
+	return nil, false
+}
+
+func (rec record) print(w io.Writer) {
+	fmt.Fprintf(w, "%s %s %s len=%d", rec.ts.Format("15:04:05.000000"),
+		rec.flow, rec.msg.Type(), rec.msg.Len())
+
+	switch msg := rec.msg.(type) {
+	case *message.HandshakeInitiation:
+		fmt.Fprintf(w, " ephemeral=%s", msg.UnencryptedEphemeral)
+	case *message.HandshakeResponse:
+		fmt.Fprintf(w, " ephemeral=%s", msg.UnencryptedEphemeral)
+	case *message.HandshakeRekey:
+		fmt.Fprintf(w, " ephemeral=%s", msg.UnencryptedEphemeral)
+	case *message.Data:
+		switch {
+		case rec.err != nil:
+			fmt.Fprintf(w, " decrypt=%q", rec.err)
+		case rec.plaintext != nil:
+			fmt.Fprintf(w, " plaintext=%d", len(rec.plaintext))
+		}
+	}
+	fmt.Fprintln(w)
+
+	if *hexDump && len(rec.plaintext) > 0 {
+		fmt.Fprint(w, hex.Dump(rec.plaintext))
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += n
+	return n, err
+}
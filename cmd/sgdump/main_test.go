@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benburkert/socketguard-go"
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+func TestDump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sgdump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		keyLog  bytes.Buffer
+		capture = &pcapWriter{}
+
+		cliAddr = &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 40000}
+		srvAddr = &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 443}
+	)
+
+	cliPriv, cliPub, _ := noise.GenerateKeyPair(rand.Reader)
+	srvPriv, srvPub, _ := noise.GenerateKeyPair(rand.Reader)
+
+	cliNet, srvNet := net.Pipe()
+	cli := socketguard.Client(capture.tap(cliNet, cliAddr, srvAddr), &socketguard.Config{
+		StaticPublic:  cliPub,
+		StaticPrivate: cliPriv,
+		PeerPublic:    srvPub,
+		RekeyAfter:    time.Nanosecond,
+		KeyLogWriter:  &keyLog,
+	})
+	srv := socketguard.Server(capture.tap(srvNet, srvAddr, cliAddr), &socketguard.Config{
+		StaticPublic:  srvPub,
+		StaticPrivate: srvPriv,
+	})
+
+	errc := make(chan error, 1)
+	go func() {
+		buf := make([]byte, len("ping!ping again!"))
+		if _, err := io.ReadFull(srv, buf); err != nil {
+			errc <- err
+			return
+		}
+		_, err := srv.Write([]byte("pong!"))
+		errc <- err
+	}()
+
+	for _, msg := range []string{"ping!", "ping again!"} {
+		time.Sleep(2 * time.Millisecond)
+		if _, err := cli.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := io.ReadFull(cli, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	pcapFile, keyLogFile := filepath.Join(dir, "capture.pcap"), filepath.Join(dir, "keylog")
+	if err := ioutil.WriteFile(pcapFile, capture.bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyLogFile, keyLog.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := run(pcapFile, keyLogFile, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+
+	// timestamps have millisecond resolution, so the nanosecond RekeyAfter
+	// may already have passed for the first write
+	if len(lines) > 2 && strings.Contains(lines[2], "HandshakeRekey") {
+		lines = append(lines[:2], lines[3:]...)
+	}
+
+	want := []string{
+		"10.0.0.1:40000 > 10.0.0.2:443 HandshakeInitiation len=104",
+		"10.0.0.2:443 > 10.0.0.1:40000 HandshakeResponse len=56",
+		"10.0.0.1:40000 > 10.0.0.2:443 Data len=21 plaintext=5",
+		"10.0.0.1:40000 > 10.0.0.2:443 HandshakeRekey len=56",
+		"10.0.0.1:40000 > 10.0.0.2:443 Data len=27 plaintext=11",
+		"10.0.0.2:443 > 10.0.0.1:40000 Data len=21 plaintext=5",
+	}
+	if len(want) != len(lines) {
+		t.Fatalf("want %d lines, got %d:\n%s", len(want), len(lines), out.String())
+	}
+	for i := range want {
+		if !strings.Contains(lines[i], want[i]) {
+			t.Errorf("want line %d to contain %q, got %q", i, want[i], lines[i])
+		}
+	}
+
+	out.Reset()
+	if err := run(pcapFile, "", &out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "plaintext=") {
+		t.Errorf("want no plaintext without key log, got:\n%s", out.String())
+	}
+}
+
+type pcapWriter struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	seq map[string]uint32
+	ts  time.Time
+}
+
+func (p *pcapWriter) tap(conn net.Conn, src, dst *net.TCPAddr) net.Conn {
+	return &tapConn{Conn: conn, p: p, src: src, dst: dst}
+}
+
+func (p *pcapWriter) bytes() []byte {
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:], pcapMagicMicro)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], 65535)
+	binary.LittleEndian.PutUint32(hdr[20:], linkTypeRaw)
+	return append(hdr, p.buf.Bytes()...)
+}
+
+func (p *pcapWriter) write(src, dst *net.TCPAddr, payload []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.seq == nil {
+		p.seq = make(map[string]uint32)
+		p.ts = time.Unix(1600000000, 0)
+	}
+	p.ts = p.ts.Add(time.Millisecond)
+
+	seq := p.seq[src.String()]
+	p.seq[src.String()] = seq + uint32(len(payload))
+
+	pkt := make([]byte, 40, 40+len(payload))
+	pkt[0] = 0x45
+	be.PutUint16(pkt[2:], uint16(40+len(payload)))
+	pkt[8], pkt[9] = 64, 6
+	copy(pkt[12:], src.IP.To4())
+	copy(pkt[16:], dst.IP.To4())
+	be.PutUint16(pkt[20:], uint16(src.Port))
+	be.PutUint16(pkt[22:], uint16(dst.Port))
+	be.PutUint32(pkt[24:], seq)
+	pkt[32] = 5 << 4
+	pkt[33] = 0x18
+	pkt = append(pkt, payload...)
+
+	var rec [16]byte
+	binary.LittleEndian.PutUint32(rec[0:], uint32(p.ts.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(p.ts.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(len(pkt)))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(len(pkt)))
+	p.buf.Write(rec[:])
+	p.buf.Write(pkt)
+}
+
+type tapConn struct {
+	net.Conn
+
+	p        *pcapWriter
+	src, dst *net.TCPAddr
+}
+
+func (c *tapConn) Write(b []byte) (int, error) {
+	c.p.write(c.src, c.dst, b)
+	return c.Conn.Write(b)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	pcapMagicMicro = 0xa1b2c3d4
+	pcapMagicNano  = 0xa1b23c4d
+	pcapngMagic    = 0x0a0d0d0a
+
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLinuxSLL = 113
+)
+
+type pcapReader struct {
+	r io.Reader
+
+	order    binary.ByteOrder
+	nano     bool
+	linkType uint32
+}
+
+func newPcapReader(r io.Reader) (*pcapReader, error) {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("pcap header: %w", err)
+	}
+
+	p := &pcapReader{r: r}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(hdr[:]) {
+		case pcapMagicMicro:
+			p.order = order
+		case pcapMagicNano:
+			p.order, p.nano = order, true
+		case pcapngMagic:
+			return nil, errors.New("pcapng files are not supported, convert with: editcap -F pcap")
+		}
+	}
+	if p.order == nil {
+		return nil, errors.New("not a pcap file")
+	}
+
+	p.linkType = p.order.Uint32(hdr[20:])
+	switch p.linkType {
+	case linkTypeNull, linkTypeEthernet, linkTypeRaw, linkTypeLinuxSLL:
+	default:
+		return nil, fmt.Errorf("unsupported link type %d", p.linkType)
+	}
+	return p, nil
+}
+
+func (p *pcapReader) next() (time.Time, []byte, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(p.r, hdr[:]); err != nil {
+		return time.Time{}, nil, err
+	}
+
+	sec, frac := p.order.Uint32(hdr[0:]), p.order.Uint32(hdr[4:])
+	if !p.nano {
+		frac *= 1000
+	}
+	ts := time.Unix(int64(sec), int64(frac))
+
+	buf := make([]byte, p.order.Uint32(hdr[8:]))
+	if _, err := io.ReadFull(p.r, buf); err != nil {
+		return ts, nil, fmt.Errorf("pcap record: %w", io.ErrUnexpectedEOF)
+	}
+	return ts, buf, nil
+}
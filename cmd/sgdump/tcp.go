@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+	"time"
+)
+
+var be = binary.BigEndian
+
+type flowKey struct {
+	src, dst string
+}
+
+func (k flowKey) reverse() flowKey {
+	return flowKey{src: k.dst, dst: k.src}
+}
+
+func (k flowKey) String() string {
+	return k.src + " > " + k.dst
+}
+
+type segment struct {
+	ts      time.Time
+	seq     uint32
+	syn     bool
+	payload []byte
+}
+
+func parsePacket(linkType uint32, b []byte) (flowKey, segment, bool) {
+	var etherType uint16
+
+	switch linkType {
+	case linkTypeNull:
+		if len(b) < 4 {
+			return flowKey{}, segment{}, false
+		}
+		// the address family is in host byte order of the capturing
+		// machine, only the IP version in the payload is reliable.
+		b = b[4:]
+	case linkTypeEthernet:
+		if len(b) < 14 {
+			return flowKey{}, segment{}, false
+		}
+		etherType, b = be.Uint16(b[12:]), b[14:]
+		for etherType == 0x8100 && len(b) >= 4 {
+			etherType, b = be.Uint16(b[2:]), b[4:]
+		}
+		if etherType != 0x0800 && etherType != 0x86dd {
+			return flowKey{}, segment{}, false
+		}
+	case linkTypeLinuxSLL:
+		if len(b) < 16 {
+			return flowKey{}, segment{}, false
+		}
+		b = b[16:]
+	}
+
+	return parseIP(b)
+}
+
+func parseIP(b []byte) (flowKey, segment, bool) {
+	var (
+		src, dst net.IP
+		proto    byte
+	)
+
+	if len(b) < 1 {
+		return flowKey{}, segment{}, false
+	}
+
+	switch b[0] >> 4 {
+	case 4:
+		if len(b) < 20 {
+			return flowKey{}, segment{}, false
+		}
+		ihl, total := int(b[0]&0x0f)*4, int(be.Uint16(b[2:]))
+		if ihl < 20 || total < ihl || len(b) < total {
+			return flowKey{}, segment{}, false
+		}
+		if be.Uint16(b[6:])&0x3fff != 0 {
+			// fragmented
+			return flowKey{}, segment{}, false
+		}
+		src, dst, proto = net.IP(b[12:16]), net.IP(b[16:20]), b[9]
+		b = b[ihl:total]
+	case 6:
+		if len(b) < 40 {
+			return flowKey{}, segment{}, false
+		}
+		total := 40 + int(be.Uint16(b[4:]))
+		if len(b) < total {
+			return flowKey{}, segment{}, false
+		}
+		// extension headers are not supported
+		src, dst, proto = net.IP(b[8:24]), net.IP(b[24:40]), b[6]
+		b = b[40:total]
+	default:
+		return flowKey{}, segment{}, false
+	}
+
+	if proto != 6 || len(b) < 20 {
+		return flowKey{}, segment{}, false
+	}
+
+	off := int(b[12]>>4) * 4
+	if off < 20 || len(b) < off {
+		return flowKey{}, segment{}, false
+	}
+
+	key := flowKey{
+		src: net.JoinHostPort(src.String(), strconv.Itoa(int(be.Uint16(b[0:])))),
+		dst: net.JoinHostPort(dst.String(), strconv.Itoa(int(be.Uint16(b[2:])))),
+	}
+	seg := segment{
+		seq:     be.Uint32(b[4:]),
+		syn:     b[13]&0x02 != 0,
+		payload: b[off:],
+	}
+	return key, seg, true
+}
+
+type mark struct {
+	end int
+	ts  time.Time
+}
+
+type stream struct {
+	key   flowKey
+	first time.Time
+
+	started bool
+	next    uint32
+	pending map[uint32]segment
+
+	buf   []byte
+	marks []mark
+}
+
+func newStream(key flowKey, ts time.Time) *stream {
+	return &stream{
+		key:     key,
+		first:   ts,
+		pending: make(map[uint32]segment),
+	}
+}
+
+func (s *stream) add(seg segment) {
+	if seg.syn {
+		s.started, s.next = true, seg.seq+1
+		seg.seq++
+	}
+	if len(seg.payload) == 0 {
+		return
+	}
+	if !s.started {
+		s.started, s.next = true, seg.seq
+	}
+
+	if diff := int32(seg.seq - s.next); diff > 0 {
+		s.pending[seg.seq] = seg
+		return
+	}
+	s.append(seg)
+
+	for {
+		seg, ok := s.pending[s.next]
+		if !ok {
+			return
+		}
+		delete(s.pending, s.next)
+		s.append(seg)
+	}
+}
+
+func (s *stream) append(seg segment) {
+	overlap := int(s.next - seg.seq)
+	if overlap >= len(seg.payload) {
+		return
+	}
+
+	s.buf = append(s.buf, seg.payload[overlap:]...)
+	s.next += uint32(len(seg.payload) - overlap)
+	s.marks = append(s.marks, mark{end: len(s.buf), ts: seg.ts})
+}
+
+func (s *stream) timeAt(offset int) time.Time {
+	for _, m := range s.marks {
+		if offset <= m.end {
+			return m.ts
+		}
+	}
+	return s.first
+}
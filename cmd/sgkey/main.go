@@ -0,0 +1,329 @@
+// Command sgkey generates and inspects socketguard keys.
+//
+// Keys are read and written as base64, the same format used by wg(8):
+//
+//	sgkey genkey [-f] [file] generate a private key
+//	sgkey pubkey             read a private key on stdin, print its public key
+//	sgkey genpsk [-f] [file] generate a preshared key
+//	sgkey inspect [-type private|public|psk] file
+//	                         validate a key file and print its fingerprint
+//	sgkey encrypt file       encrypt a key file with a passphrase
+//	sgkey decrypt file       remove the passphrase from a key file
+//	sgkey passwd file        change the passphrase of an encrypted key file
+//
+// genkey and genpsk refuse to replace an existing file unless -f is set.
+//
+// Passphrases are read from the file named by -passphrase-file, else the
+// SGKEY_PASSPHRASE environment variable, else prompted for on the terminal.
+// passwd reads the new passphrase from -new-passphrase-file or
+// SGKEY_NEW_PASSPHRASE.
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "genkey":
+		err = genkey(args, os.Stdout)
+	case "pubkey":
+		err = pubkey(args, os.Stdin, os.Stdout)
+	case "genpsk":
+		err = genpsk(args, os.Stdout)
+	case "inspect":
+		err = inspect(args, os.Stdout)
+	case "encrypt":
+		err = encrypt(args)
+	case "decrypt":
+		err = decrypt(args)
+	case "passwd":
+		err = passwd(args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sgkey: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: sgkey <command> [arguments]
+
+commands:
+	genkey [-f] [file] generate a private key
+	pubkey             read a private key on stdin, print its public key
+	genpsk [-f] [file] generate a preshared key
+	inspect [-type private|public|psk] file
+	                   validate a key file and print its fingerprint
+	encrypt [-passphrase-file file] file
+	                   encrypt a key file with a passphrase
+	decrypt [-passphrase-file file] file
+	                   remove the passphrase from a key file
+	passwd [-passphrase-file file] [-new-passphrase-file file] file
+	                   change the passphrase of an encrypted key file
+`)
+}
+
+func genkey(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("genkey", flag.ExitOnError)
+	force := fs.Bool("f", false, "replace an existing key file")
+	fs.Parse(args)
+
+	priv, _, err := noise.GenerateKeyPair(rand.Reader)
+	if err != nil {
+		return err
+	}
+	return output(fs.Args(), priv, *force, w)
+}
+
+func genpsk(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("genpsk", flag.ExitOnError)
+	force := fs.Bool("f", false, "replace an existing key file")
+	fs.Parse(args)
+
+	psk, err := noise.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	return output(fs.Args(), psk, *force, w)
+}
+
+func pubkey(args []string, r io.Reader, w io.Writer) error {
+	if len(args) != 0 {
+		return fmt.Errorf("pubkey: unexpected arguments: %q", args)
+	}
+
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	priv, err := noise.ParseKey(string(buf))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, noise.PrivateKey(priv).Public())
+	return nil
+}
+
+func inspect(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	typ := fs.String("type", "private", "key type: private, public or psk")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("inspect: key file required")
+	}
+	name := fs.Arg(0)
+
+	var (
+		key noise.Key
+		err error
+	)
+	switch *typ {
+	case "private", "psk":
+		key, err = noise.LoadKeyFile(name)
+	case "public":
+		var buf []byte
+		if buf, err = ioutil.ReadFile(name); err == nil {
+			key, err = noise.ParseKey(string(buf))
+		}
+	default:
+		return fmt.Errorf("inspect: unknown key type %q", *typ)
+	}
+	if err != nil {
+		return err
+	}
+	if key == (noise.Key{}) {
+		return fmt.Errorf("inspect: %s: all-zero key", name)
+	}
+
+	fmt.Fprintf(w, "file:        %s\n", name)
+	fmt.Fprintf(w, "type:        %s\n", *typ)
+	if *typ == "private" {
+		pub := noise.PrivateKey(key).Public()
+		fmt.Fprintf(w, "public key:  %s\n", pub)
+		fmt.Fprintf(w, "fingerprint: %s\n", fingerprint(pub))
+	} else {
+		fmt.Fprintf(w, "fingerprint: %s\n", fingerprint(key))
+	}
+	return nil
+}
+
+func encrypt(args []string) error {
+	fs := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	pass := passphraseFlag(fs, "passphrase-file", "SGKEY_PASSPHRASE", "New passphrase: ", true)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("encrypt: key file required")
+	}
+	name := fs.Arg(0)
+
+	key, err := noise.LoadKeyFile(name)
+	if err != nil {
+		return err
+	}
+	return replace(name, func(tmp string) error {
+		return noise.EncryptKeyFile(tmp, key, pass)
+	})
+}
+
+func decrypt(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	pass := passphraseFlag(fs, "passphrase-file", "SGKEY_PASSPHRASE", "Passphrase: ", false)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("decrypt: key file required")
+	}
+	name := fs.Arg(0)
+
+	key, err := noise.DecryptKeyFile(name, pass)
+	if err != nil {
+		return err
+	}
+	return replace(name, func(tmp string) error {
+		return noise.WriteKeyFile(tmp, key)
+	})
+}
+
+func passwd(args []string) error {
+	fs := flag.NewFlagSet("passwd", flag.ExitOnError)
+	oldPass := passphraseFlag(fs, "passphrase-file", "SGKEY_PASSPHRASE", "Old passphrase: ", false)
+	newPass := passphraseFlag(fs, "new-passphrase-file", "SGKEY_NEW_PASSPHRASE", "New passphrase: ", true)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("passwd: key file required")
+	}
+	name := fs.Arg(0)
+
+	key, err := noise.DecryptKeyFile(name, oldPass)
+	if err != nil {
+		return err
+	}
+	return replace(name, func(tmp string) error {
+		return noise.EncryptKeyFile(tmp, key, newPass)
+	})
+}
+
+func passphraseFlag(fs *flag.FlagSet, name, env, prompt string, confirm bool) noise.Passphrase {
+	file := fs.String(name, "", "read the passphrase from `file` (default $"+env+" or prompt)")
+
+	return func() ([]byte, error) {
+		if *file != "" {
+			return noise.PassphraseFile(*file)()
+		}
+		if _, ok := os.LookupEnv(env); ok {
+			return noise.PassphraseEnv(env)()
+		}
+
+		fd := int(os.Stdin.Fd())
+		if !terminal.IsTerminal(fd) {
+			return nil, fmt.Errorf("no passphrase: set -%s or $%s", name, env)
+		}
+
+		fmt.Fprint(os.Stderr, prompt)
+		pass, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil || !confirm {
+			return pass, err
+		}
+
+		fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+		again, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(pass, again) {
+			return nil, fmt.Errorf("passphrases do not match")
+		}
+		return pass, nil
+	}
+}
+
+// replace atomically replaces the key file name with the one written by fn.
+func replace(name string, fn func(tmp string) error) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	f.Close()
+
+	if err := fn(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func output(args []string, key noise.Key, force bool, w io.Writer) error {
+	switch len(args) {
+	case 0:
+		fmt.Fprintln(w, key)
+		return nil
+	case 1:
+		if force {
+			return replace(args[0], func(tmp string) error {
+				return noise.WriteKeyFile(tmp, key)
+			})
+		}
+		return create(args[0], key)
+	default:
+		return fmt.Errorf("unexpected arguments: %q", args[1:])
+	}
+}
+
+// create writes key to the new file name, refusing to replace an existing
+// file.
+func create(name string, key noise.Key) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%s already exists, use -f to replace it", name)
+		}
+		return err
+	}
+	f.Close()
+
+	if err := noise.WriteKeyFile(name, key); err != nil {
+		os.Remove(name)
+		return err
+	}
+	return nil
+}
+
+func fingerprint(key noise.Key) string {
+	sum := blake2s.Sum256(key[:])
+	return "BLAKE2s:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+func TestGenkeyPubkey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sgkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "private.key")
+
+	var out bytes.Buffer
+	if err := genkey([]string{name}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("want no output writing a key file, got %q", out.String())
+	}
+
+	priv, err := noise.LoadKeyFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pubkey(nil, bytes.NewReader(buf), &out); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := noise.PrivateKey(priv).Public().String()+"\n", out.String(); want != got {
+		t.Errorf("want public key %q, got %q", want, got)
+	}
+
+	if err := genkey([]string{name}, &out); err == nil {
+		t.Error("want genkey to refuse an existing key file")
+	}
+	if key, err := noise.LoadKeyFile(name); err != nil {
+		t.Fatal(err)
+	} else if key != priv {
+		t.Error("want existing key file unchanged")
+	}
+
+	if err := genkey([]string{"-f", name}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := noise.LoadKeyFile(name); err != nil {
+		t.Fatal(err)
+	} else if key == priv {
+		t.Error("want -f to replace the key file")
+	}
+
+	// without a file the key is printed
+	out.Reset()
+	if err := genkey(nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := noise.ParseKey(out.String()); err != nil {
+		t.Errorf("want printed key, got %q: %v", out.String(), err)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sgkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	priv, pub, err := noise.GenerateKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+
+		typ  string
+		data string
+		mode os.FileMode
+
+		out string
+		err bool
+	}{
+		{
+			name: "private",
+			typ:  "private",
+			data: priv.String() + "\n",
+			mode: 0600,
+			out:  "public key:  " + pub.String(),
+		},
+		{
+			name: "public",
+			typ:  "public",
+			data: pub.String() + "\n",
+			mode: 0644,
+			out:  "fingerprint: " + fingerprint(pub),
+		},
+		{
+			name: "bad-base64",
+			typ:  "private",
+			data: "not a key\n",
+			mode: 0600,
+			err:  true,
+		},
+		{
+			name: "short-key",
+			typ:  "psk",
+			data: "AAAA\n",
+			mode: 0600,
+			err:  true,
+		},
+		{
+			name: "zero-key",
+			typ:  "private",
+			data: noise.Key{}.String() + "\n",
+			mode: 0600,
+			err:  true,
+		},
+		{
+			name: "readable-private",
+			typ:  "private",
+			data: priv.String() + "\n",
+			mode: 0644,
+			err:  true,
+		},
+		{
+			name: "unknown-type",
+			typ:  "secret",
+			data: priv.String() + "\n",
+			mode: 0600,
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			name := filepath.Join(dir, test.name)
+			if err := ioutil.WriteFile(name, []byte(test.data), test.mode); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(name, test.mode); err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			err := inspect([]string{"-type", test.typ, name}, &out)
+			if test.err {
+				if err == nil {
+					t.Fatalf("want error, got output %q", out.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out.String(), test.out) {
+				t.Errorf("want output containing %q, got %q", test.out, out.String())
+			}
+		})
+	}
+
+	if err := inspect([]string{filepath.Join(dir, "missing")}, ioutil.Discard); err == nil {
+		t.Error("want error inspecting a missing file")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/benburkert/socketguard-go"
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+type config struct {
+	PrivateKeyFile string `json:"private_key_file"`
+
+	Routes []*route `json:"routes"`
+}
+
+type route struct {
+	Name string `json:"name"`
+	Mode string `json:"mode"`
+
+	Listen   string `json:"listen"`
+	Backend  string `json:"backend"`
+	Upstream string `json:"upstream"`
+
+	PrivateKeyFile string      `json:"private_key_file"`
+	PSKFile        string      `json:"psk_file"`
+	Peers          []noise.Key `json:"peers"`
+
+	Kernel  bool    `json:"kernel"`
+	OptName uintptr `json:"opt_name"`
+
+	sgConfig *socketguard.Config
+}
+
+func loadConfig(name string) (*config, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config := new(config)
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(config); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if len(config.Routes) == 0 {
+		return nil, fmt.Errorf("%s: no routes", name)
+	}
+
+	dir := filepath.Dir(name)
+	for i, route := range config.Routes {
+		if route.Name == "" {
+			route.Name = fmt.Sprintf("route%d", i)
+		}
+		if route.PrivateKeyFile == "" {
+			route.PrivateKeyFile = config.PrivateKeyFile
+		}
+
+		if err := route.load(dir); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", name, route.Name, err)
+		}
+	}
+	return config, nil
+}
+
+func (r *route) load(dir string) error {
+	switch r.Mode {
+	case "server":
+		if r.Backend == "" {
+			return fmt.Errorf("backend required")
+		}
+	case "client":
+		if r.Upstream == "" {
+			return fmt.Errorf("upstream required")
+		}
+		if len(r.Peers) != 1 {
+			return fmt.Errorf("client mode requires exactly one peer")
+		}
+	default:
+		return fmt.Errorf("unknown mode %q", r.Mode)
+	}
+
+	if r.Listen == "" {
+		return fmt.Errorf("listen required")
+	}
+	if len(r.Peers) == 0 {
+		return fmt.Errorf("peers required")
+	}
+	if r.PrivateKeyFile == "" {
+		return fmt.Errorf("private_key_file required")
+	}
+
+	priv, err := noise.LoadKeyFile(resolve(dir, r.PrivateKeyFile))
+	if err != nil {
+		return err
+	}
+
+	r.sgConfig = &socketguard.Config{
+		StaticPrivate: priv,
+		OptName:       r.OptName,
+		PreferGo:      !r.Kernel,
+	}
+	if r.Mode == "client" || (r.Kernel && len(r.Peers) == 1) {
+		r.sgConfig.PeerPublic = r.Peers[0]
+	}
+
+	if r.PSKFile != "" {
+		if r.sgConfig.PresharedKey, err = noise.LoadKeyFile(resolve(dir, r.PSKFile)); err != nil {
+			return err
+		}
+	}
+
+	return r.sgConfig.Validate()
+}
+
+func resolve(dir, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
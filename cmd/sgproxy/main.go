@@ -0,0 +1,74 @@
+// Command sgproxy terminates and originates socketguard connections in front
+// of plaintext TCP services.
+//
+// A route in server mode accepts socketguard connections and forwards the
+// plaintext to a backend. A route in client mode accepts plaintext
+// connections and forwards them to a socketguard upstream. Routes are read
+// from a JSON config file:
+//
+//	{
+//	  "private_key_file": "/etc/sgproxy/private.key",
+//	  "routes": [
+//	    {
+//	      "name": "api",
+//	      "mode": "server",
+//	      "listen": ":8443",
+//	      "backend": "127.0.0.1:8080",
+//	      "peers": ["<base64 public key>", "<base64 public key>"]
+//	    },
+//	    {
+//	      "name": "db",
+//	      "mode": "client",
+//	      "listen": "127.0.0.1:5432",
+//	      "upstream": "db.internal:5433",
+//	      "peers": ["<base64 public key>"],
+//	      "psk_file": "/etc/sgproxy/db.psk"
+//	    }
+//	  ]
+//	}
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var configFile = flag.String("config", "sgproxy.json", "config file")
+
+func main() {
+	flag.Parse()
+
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sgproxy: %s\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+		<-sigc
+		cancel()
+	}()
+
+	errc := make(chan error, len(config.Routes))
+	for _, route := range config.Routes {
+		route := route
+		go func() { errc <- route.serve(ctx) }()
+	}
+
+	for range config.Routes {
+		if err := <-errc; err != nil {
+			log.Printf("sgproxy: %s", err)
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/benburkert/socketguard-go"
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sgproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	priv, _ := mustKeyPair(t)
+	_, peer1 := mustKeyPair(t)
+	_, peer2 := mustKeyPair(t)
+
+	if err := noise.WriteKeyFile(filepath.Join(dir, "private.key"), priv); err != nil {
+		t.Fatal(err)
+	}
+
+	peers := `["` + peer1.String() + `"]`
+	twoPeers := `["` + peer1.String() + `", "` + peer2.String() + `"]`
+
+	tests := []struct {
+		name, config, err string
+	}{
+		{
+			name:   "server",
+			config: `{"private_key_file": "private.key", "routes": [{"mode": "server", "listen": ":0", "backend": "127.0.0.1:1", "peers": ` + twoPeers + `}]}`,
+		},
+		{
+			name:   "client",
+			config: `{"routes": [{"mode": "client", "listen": ":0", "upstream": "127.0.0.1:1", "peers": ` + peers + `, "private_key_file": "private.key"}]}`,
+		},
+		{
+			name:   "kernel-server",
+			config: `{"private_key_file": "private.key", "routes": [{"mode": "server", "kernel": true, "listen": ":0", "backend": "127.0.0.1:1", "peers": ` + twoPeers + `}]}`,
+		},
+		{
+			name:   "no-routes",
+			config: `{"private_key_file": "private.key", "routes": []}`,
+			err:    "no routes",
+		},
+		{
+			name:   "unknown-field",
+			config: `{"private_key_file": "private.key", "routes": [], "bogus": 1}`,
+			err:    "unknown field",
+		},
+		{
+			name:   "unknown-mode",
+			config: `{"private_key_file": "private.key", "routes": [{"mode": "bridge", "listen": ":0", "peers": ` + peers + `}]}`,
+			err:    `route0: unknown mode "bridge"`,
+		},
+		{
+			name:   "missing-backend",
+			config: `{"private_key_file": "private.key", "routes": [{"name": "api", "mode": "server", "listen": ":0", "peers": ` + peers + `}]}`,
+			err:    "api: backend required",
+		},
+		{
+			name:   "missing-upstream",
+			config: `{"private_key_file": "private.key", "routes": [{"mode": "client", "listen": ":0", "peers": ` + peers + `}]}`,
+			err:    "upstream required",
+		},
+		{
+			name:   "client-two-peers",
+			config: `{"private_key_file": "private.key", "routes": [{"mode": "client", "listen": ":0", "upstream": "127.0.0.1:1", "peers": ` + twoPeers + `}]}`,
+			err:    "client mode requires exactly one peer",
+		},
+		{
+			name:   "missing-listen",
+			config: `{"private_key_file": "private.key", "routes": [{"mode": "server", "backend": "127.0.0.1:1", "peers": ` + peers + `}]}`,
+			err:    "listen required",
+		},
+		{
+			name:   "missing-peers",
+			config: `{"private_key_file": "private.key", "routes": [{"mode": "server", "listen": ":0", "backend": "127.0.0.1:1"}]}`,
+			err:    "peers required",
+		},
+		{
+			name:   "missing-private-key",
+			config: `{"routes": [{"mode": "server", "listen": ":0", "backend": "127.0.0.1:1", "peers": ` + peers + `}]}`,
+			err:    "private_key_file required",
+		},
+		{
+			name:   "unreadable-private-key",
+			config: `{"private_key_file": "missing.key", "routes": [{"mode": "server", "listen": ":0", "backend": "127.0.0.1:1", "peers": ` + peers + `}]}`,
+			err:    "missing.key",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := filepath.Join(dir, test.name+".json")
+			if err := ioutil.WriteFile(name, []byte(test.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := loadConfig(name)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("want error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			route := config.Routes[0]
+			if want, got := priv, route.sgConfig.StaticPrivate; want != got {
+				t.Errorf("want private key loaded relative to the config file")
+			}
+			if want, got := route.Mode == "client", route.sgConfig.PeerPublic == peer1; want != got {
+				t.Errorf("want pinned peer %t, got %t", want, got)
+			}
+		})
+	}
+}
+
+func TestProxy(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srvPriv, srvPub := mustKeyPair(t)
+	cliPriv, cliPub := mustKeyPair(t)
+	otherPriv, otherPub := mustKeyPair(t)
+
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	server := &route{
+		Name:    "server",
+		Mode:    "server",
+		Listen:  "127.0.0.1:0",
+		Backend: backend.Addr().String(),
+		Peers:   []noise.Key{cliPub},
+
+		sgConfig: &socketguard.Config{
+			StaticPrivate: srvPriv,
+			PreferGo:      true,
+		},
+	}
+	srvLn := mustServe(ctx, t, server)
+
+	client := &route{
+		Name:     "client",
+		Mode:     "client",
+		Listen:   "127.0.0.1:0",
+		Upstream: srvLn.Addr().String(),
+		Peers:    []noise.Key{srvPub},
+
+		sgConfig: &socketguard.Config{
+			StaticPrivate: cliPriv,
+			PeerPublic:    srvPub,
+			PreferGo:      true,
+		},
+	}
+	cliLn := mustServe(ctx, t, client)
+
+	conn, err := net.Dial("tcp", cliLn.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("ping!")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "ping!", string(buf); want != got {
+		t.Errorf("want echo %q, got %q", want, got)
+	}
+
+	// a peer missing from the server route is not proxied
+	other, err := socketguard.Dial(ctx, "tcp", srvLn.Addr().String(), &socketguard.Config{
+		StaticPrivate: otherPriv,
+		StaticPublic:  otherPub,
+		PeerPublic:    srvPub,
+		PreferGo:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	other.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := other.Write([]byte("ping!")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(other, buf); err == nil {
+		t.Error("want unauthorized peer disconnected")
+	}
+}
+
+func TestAuthenticateKernel(t *testing.T) {
+	_, peerPub := mustKeyPair(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	tests := []struct {
+		name     string
+		finishAt int
+		err      bool
+	}{
+		{name: "finished", finishAt: 0},
+		{name: "in-progress", finishAt: 3},
+		{name: "timeout", finishAt: -1, err: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			defer func(fn func(*socketguard.Config, syscall.Conn) (*socketguard.PeerInfo, error)) {
+				peerInfo = fn
+			}(peerInfo)
+
+			var calls int
+			peerInfo = func(*socketguard.Config, syscall.Conn) (*socketguard.PeerInfo, error) {
+				info := &socketguard.PeerInfo{State: socketguard.HandshakeInitiated}
+				if calls == test.finishAt {
+					info = &socketguard.PeerInfo{
+						PeerPublic: peerPub,
+						State:      socketguard.HandshakeFinished,
+					}
+				}
+				calls++
+				return info, nil
+			}
+
+			r := &route{
+				Name:     test.name,
+				Peers:    []noise.Key{peerPub},
+				sgConfig: new(socketguard.Config),
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			peer, err := r.authenticate(ctx, conn)
+			if test.err {
+				if err == nil {
+					t.Fatal("want handshake timeout error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := peerPub, peer; want != got {
+				t.Errorf("want peer %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func mustServe(ctx context.Context, t *testing.T, r *route) net.Listener {
+	t.Helper()
+
+	ln, err := r.listen(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go r.accept(ctx, ln)
+	return ln
+}
+
+func mustKeyPair(t *testing.T) (priv, pub noise.Key) {
+	t.Helper()
+
+	priv, pub, err := noise.GenerateKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, pub
+}
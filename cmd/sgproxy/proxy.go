@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/benburkert/socketguard-go"
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+// handshakeTimeout bounds how long authenticate waits on a kernel handshake,
+// which the module runs in the background after connect and accept.
+const handshakeTimeout = 10 * time.Second
+
+var peerInfo = (*socketguard.Config).PeerInfo
+
+func (r *route) serve(ctx context.Context) error {
+	ln, err := r.listen(ctx)
+	if err != nil {
+		return err
+	}
+	return r.accept(ctx, ln)
+}
+
+func (r *route) listen(ctx context.Context) (net.Listener, error) {
+	var (
+		ln  net.Listener
+		err error
+	)
+
+	switch r.Mode {
+	case "server":
+		ln, err = socketguard.Listen(ctx, "tcp", r.Listen, r.sgConfig)
+	case "client":
+		ln, err = new(net.ListenConfig).Listen(ctx, "tcp", r.Listen)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", r.Name, err)
+	}
+	return ln, nil
+}
+
+func (r *route) accept(ctx context.Context, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	log.Printf("%s: %s mode listening on %s", r.Name, r.Mode, ln.Addr())
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("%s: %w", r.Name, err)
+		}
+
+		switch r.Mode {
+		case "server":
+			go r.terminate(ctx, conn)
+		case "client":
+			go r.originate(ctx, conn)
+		}
+	}
+}
+
+func (r *route) terminate(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	peer, err := r.authenticate(ctx, conn)
+	if err != nil {
+		log.Printf("%s: %s: handshake failed: %s", r.Name, conn.RemoteAddr(), err)
+		return
+	}
+
+	backend, err := new(net.Dialer).DialContext(ctx, "tcp", r.Backend)
+	if err != nil {
+		log.Printf("%s: %s: peer %s: %s", r.Name, conn.RemoteAddr(), peer, err)
+		return
+	}
+	defer backend.Close()
+
+	log.Printf("%s: %s: peer %s: connected to %s", r.Name, conn.RemoteAddr(), peer, r.Backend)
+	r.proxy(conn, backend, peer)
+}
+
+func (r *route) originate(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	upstream, err := socketguard.Dial(ctx, "tcp", r.Upstream, r.sgConfig)
+	if err != nil {
+		log.Printf("%s: %s: %s", r.Name, conn.RemoteAddr(), err)
+		return
+	}
+	defer upstream.Close()
+
+	peer, err := r.authenticate(ctx, upstream)
+	if err != nil {
+		log.Printf("%s: %s: handshake failed: %s", r.Name, r.Upstream, err)
+		return
+	}
+
+	log.Printf("%s: %s: peer %s: connected to %s", r.Name, conn.RemoteAddr(), peer, r.Upstream)
+	r.proxy(conn, upstream, peer)
+}
+
+func (r *route) authenticate(ctx context.Context, conn net.Conn) (noise.Key, error) {
+	var peer noise.Key
+
+	switch conn := conn.(type) {
+	case *socketguard.Conn:
+		if err := conn.Handshake(); err != nil {
+			return peer, err
+		}
+		peer = conn.ConnectionState().PeerPublic
+	case syscall.Conn:
+		ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+		defer cancel()
+
+		info, err := r.waitHandshake(ctx, conn)
+		if err != nil {
+			return peer, err
+		}
+		peer = info.PeerPublic
+	default:
+		return peer, fmt.Errorf("unsupported connection type %T", conn)
+	}
+
+	for _, allowed := range r.Peers {
+		if peer == allowed {
+			return peer, nil
+		}
+	}
+	return peer, fmt.Errorf("peer %s not allowed", peer)
+}
+
+// waitHandshake polls the kernel peer info until the handshake on conn has
+// finished or ctx is done.
+func (r *route) waitHandshake(ctx context.Context, conn syscall.Conn) (*socketguard.PeerInfo, error) {
+	delay := time.Millisecond
+	for {
+		info, err := peerInfo(r.sgConfig, conn)
+		if err != nil {
+			return nil, err
+		}
+		if info.State == socketguard.HandshakeFinished {
+			return info, nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("handshake not finished: %s", info.State)
+		case <-timer.C:
+		}
+
+		if delay *= 2; delay > 100*time.Millisecond {
+			delay = 100 * time.Millisecond
+		}
+	}
+}
+
+func (r *route) proxy(a, b net.Conn, peer noise.Key) {
+	errc := make(chan error, 2)
+	go func() { errc <- halfCopy(a, b) }()
+	go func() { errc <- halfCopy(b, a) }()
+
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			log.Printf("%s: %s: peer %s: %s", r.Name, a.RemoteAddr(), peer, err)
+			return
+		}
+	}
+	log.Printf("%s: %s: peer %s: closed", r.Name, a.RemoteAddr(), peer)
+}
+
+func halfCopy(dst, src net.Conn) error {
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package socketguard
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+// ConfigFile is a WireGuard style configuration file:
+//
+//	[Interface]
+//	PrivateKey = <base64 private key>
+//	ListenAddress = 0.0.0.0:4443
+//	RekeyAfter = 2m
+//	RejectAfter = 3m
+//	OptName = 0
+//	PreferGo = true
+//
+//	[Peer]
+//	Name = alice
+//	PublicKey = <base64 public key>
+//	PresharedKey = <base64 preshared key>
+//	RekeyAfter = 1m
+//	RejectAfter = 90s
+//
+// Keys are case insensitive and "#" starts a comment. Config.Peers holds
+// every [Peer] section; when there is exactly one, its public and preshared
+// keys are also used for Config.PeerPublic and Config.PresharedKey.
+type ConfigFile struct {
+	Config        *Config
+	ListenAddress string
+	Peers         []*Peer
+}
+
+type ConfigFileError struct {
+	Name string
+	Line int
+	Err  error
+}
+
+func (e *ConfigFileError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("socketguard: line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("socketguard: %s:%d: %v", e.Name, e.Line, e.Err)
+}
+
+func (e *ConfigFileError) Unwrap() error { return e.Err }
+
+func LoadConfigFile(name string) (*ConfigFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	file, err := ParseConfigFile(f)
+	if cerr, ok := err.(*ConfigFileError); ok {
+		cerr.Name = name
+	}
+	return file, err
+}
+
+func ParseConfigFile(r io.Reader) (*ConfigFile, error) {
+	var (
+		file = &ConfigFile{Config: new(Config)}
+
+		section, header string
+		interfaceAt     int
+		peer            *Peer
+		peerAt          = make(map[*Peer]int)
+		seen            map[string]bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fail := func(format string, args ...interface{}) error {
+			return &ConfigFileError{Line: line, Err: fmt.Errorf(format, args...)}
+		}
+
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			header = text
+			switch section = strings.ToLower(strings.TrimSpace(text[1 : len(text)-1])); section {
+			case "interface":
+				if interfaceAt != 0 {
+					return nil, fail("duplicate %s section, first on line %d", header, interfaceAt)
+				}
+				interfaceAt, peer = line, nil
+			case "peer":
+				peer = new(Peer)
+				peerAt[peer] = line
+				file.Peers = append(file.Peers, peer)
+			default:
+				return nil, fail("unknown section %s", text)
+			}
+			seen = make(map[string]bool)
+			continue
+		}
+
+		i := strings.IndexByte(text, '=')
+		if i < 0 {
+			return nil, fail("expected key = value, got %q", text)
+		}
+		key, value := strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+		if seen == nil {
+			return nil, fail("%s outside of a section", key)
+		}
+
+		lkey := strings.ToLower(key)
+		if seen[lkey] {
+			return nil, fail("duplicate key %s", key)
+		}
+		seen[lkey] = true
+
+		var err error
+		switch {
+		case section == "interface" && lkey == "privatekey":
+			file.Config.StaticPrivate, err = noise.ParseKey(value)
+		case section == "interface" && lkey == "listenaddress":
+			file.ListenAddress = value
+		case section == "interface" && lkey == "rekeyafter":
+			file.Config.RekeyAfter, err = time.ParseDuration(value)
+		case section == "interface" && lkey == "rejectafter":
+			file.Config.RejectAfter, err = time.ParseDuration(value)
+		case section == "interface" && lkey == "optname":
+			var v uint64
+			v, err = strconv.ParseUint(value, 0, 0)
+			file.Config.OptName = uintptr(v)
+		case section == "interface" && lkey == "prefergo":
+			file.Config.PreferGo, err = strconv.ParseBool(value)
+		case section == "peer" && lkey == "name":
+			peer.Name = value
+		case section == "peer" && lkey == "publickey":
+			peer.PublicKey, err = noise.ParseKey(value)
+		case section == "peer" && lkey == "presharedkey":
+			peer.PresharedKey, err = noise.ParseKey(value)
+		case section == "peer" && lkey == "rekeyafter":
+			peer.RekeyAfter, err = time.ParseDuration(value)
+		case section == "peer" && lkey == "rejectafter":
+			peer.RejectAfter, err = time.ParseDuration(value)
+		default:
+			return nil, fail("unknown key %s in %s section", key, header)
+		}
+		if err != nil {
+			var nerr *strconv.NumError
+			if errors.As(err, &nerr) {
+				err = nerr.Err
+			}
+			return nil, fail("invalid %s: %v", key, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[noise.Key]*Peer, len(file.Peers))
+	for _, peer := range file.Peers {
+		if peer.PublicKey == (noise.Key{}) {
+			return nil, &ConfigFileError{Line: peerAt[peer], Err: ErrMissingPeerKey}
+		}
+		if dup, ok := keys[peer.PublicKey]; ok {
+			return nil, &ConfigFileError{
+				Line: peerAt[peer],
+				Err:  fmt.Errorf("duplicate public key, first on line %d", peerAt[dup]),
+			}
+		}
+		keys[peer.PublicKey] = peer
+	}
+
+	cfg := file.Config
+	cfg.StaticPublic = cfg.staticPublic()
+
+	var err error
+	if cfg.Peers, err = NewPeerRegistry(file.Peers...); err != nil {
+		return nil, err
+	}
+	if len(file.Peers) == 1 {
+		cfg.PeerPublic = file.Peers[0].PublicKey
+		cfg.PresharedKey = file.Peers[0].PresharedKey
+	}
+	return file, nil
+}
+
+func (f *ConfigFile) MarshalText() ([]byte, error) {
+	var buf bytes.Buffer
+
+	cfg := f.Config
+	if cfg == nil {
+		cfg = new(Config)
+	}
+
+	buf.WriteString("[Interface]\n")
+	if cfg.StaticPrivate != (noise.Key{}) {
+		fmt.Fprintf(&buf, "PrivateKey = %s\n", cfg.StaticPrivate)
+	}
+	if f.ListenAddress != "" {
+		fmt.Fprintf(&buf, "ListenAddress = %s\n", f.ListenAddress)
+	}
+	if cfg.RekeyAfter != 0 {
+		fmt.Fprintf(&buf, "RekeyAfter = %s\n", cfg.RekeyAfter)
+	}
+	if cfg.RejectAfter != 0 {
+		fmt.Fprintf(&buf, "RejectAfter = %s\n", cfg.RejectAfter)
+	}
+	if cfg.OptName != 0 {
+		fmt.Fprintf(&buf, "OptName = %d\n", cfg.OptName)
+	}
+	if cfg.PreferGo {
+		buf.WriteString("PreferGo = true\n")
+	}
+
+	peers := f.Peers
+	if len(peers) == 0 && cfg.PeerPublic != (noise.Key{}) {
+		peers = []*Peer{{
+			PublicKey:    cfg.PeerPublic,
+			PresharedKey: cfg.PresharedKey,
+		}}
+	}
+
+	for _, peer := range peers {
+		if strings.ContainsAny(peer.Name, "#\n") {
+			return nil, fmt.Errorf("socketguard: peer %q: invalid name", peer.Name)
+		}
+
+		buf.WriteString("\n[Peer]\n")
+		if peer.Name != "" {
+			fmt.Fprintf(&buf, "Name = %s\n", peer.Name)
+		}
+		fmt.Fprintf(&buf, "PublicKey = %s\n", peer.PublicKey)
+		if peer.PresharedKey != (noise.Key{}) {
+			fmt.Fprintf(&buf, "PresharedKey = %s\n", peer.PresharedKey)
+		}
+		if peer.RekeyAfter != 0 {
+			fmt.Fprintf(&buf, "RekeyAfter = %s\n", peer.RekeyAfter)
+		}
+		if peer.RejectAfter != 0 {
+			fmt.Fprintf(&buf, "RejectAfter = %s\n", peer.RejectAfter)
+		}
+	}
+	return buf.Bytes(), nil
+}
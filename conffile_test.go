@@ -0,0 +1,134 @@
+package socketguard
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benburkert/socketguard-go/internal/must"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	psk := must.GenerateKey()
+	_, bobPub := must.GenerateKeyPair()
+
+	file, err := ParseConfigFile(strings.NewReader(`
+# socketguard server
+[Interface]
+PrivateKey = ` + srvPriv.String() + `
+ListenAddress = 127.0.0.1:4443 # loopback only
+rekeyafter = 2m
+RejectAfter = 3m
+OptName = 0x10
+PreferGo = true
+
+[Peer]
+Name = alice
+PublicKey = ` + cliPub.String() + `
+PresharedKey = ` + psk.String() + `
+RekeyAfter = 1m
+
+[peer]
+Name = bob
+PublicKey = ` + bobPub.String() + `
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := file.Config
+	if want, got := srvPub, cfg.StaticPublic; want != got {
+		t.Errorf("want static public %s, got %s", want, got)
+	}
+	if want, got := "127.0.0.1:4443", file.ListenAddress; want != got {
+		t.Errorf("want listen address %q, got %q", want, got)
+	}
+	if cfg.RekeyAfter != 2*time.Minute || cfg.RejectAfter != 3*time.Minute {
+		t.Errorf("want rekey/reject after 2m/3m, got %s/%s", cfg.RekeyAfter, cfg.RejectAfter)
+	}
+	if want, got := uintptr(0x10), cfg.OptName; want != got {
+		t.Errorf("want opt name %d, got %d", want, got)
+	}
+	if !cfg.PreferGo {
+		t.Error("want PreferGo")
+	}
+
+	alice, ok := cfg.Peers.Lookup(cliPub)
+	if !ok {
+		t.Fatal("missing alice in peer registry")
+	}
+	if want, got := (&Peer{
+		Name:         "alice",
+		PublicKey:    cliPub,
+		PresharedKey: psk,
+		RekeyAfter:   time.Minute,
+	}), alice; !reflect.DeepEqual(want, got) {
+		t.Errorf("want peer %+v, got %+v", want, got)
+	}
+	if _, ok := cfg.Peers.Lookup(bobPub); !ok {
+		t.Error("missing bob in peer registry")
+	}
+
+	text, err := file.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file2, err := ParseConfigFile(strings.NewReader(string(text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(file.Peers, file2.Peers) {
+		t.Errorf("want peers %+v, got %+v", file.Peers, file2.Peers)
+	}
+	cfg2 := *file2.Config
+	cfg2.Peers = cfg.Peers
+	if !reflect.DeepEqual(*cfg, cfg2) {
+		t.Errorf("want config %+v, got %+v", *cfg, cfg2)
+	}
+
+	text2, err := file2.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := string(text), string(text2); want != got {
+		t.Errorf("want marshaled config:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestParseConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		line int
+		err  string
+	}{
+		{"PrivateKey = x", 1, "outside of a section"},
+		{"[Interface]\n\n[Foo]", 3, "unknown section [Foo]"},
+		{"[Interface]\nListenPort = 51820", 2, "unknown key ListenPort"},
+		{"[Interface]\nPrivateKey = nope", 2, "invalid PrivateKey"},
+		{"[Interface]\nRekeyAfter = 2m\nrekeyafter = 3m", 3, "duplicate key"},
+		{"[Interface]\n[Interface]", 2, "duplicate [Interface] section, first on line 1"},
+		{"[Interface]\nPreferGo = maybe", 2, "invalid PreferGo: invalid syntax"},
+		{"[Interface]\nPreferGo", 2, "expected key = value"},
+		{"[Peer]\nName = alice\n\n[Peer]\nPublicKey = " + cliPub.String(), 1, ErrMissingPeerKey.Error()},
+		{"[Peer]\nPublicKey = " + cliPub.String() + "\n[Peer]\nPublicKey = " + cliPub.String(), 3, "duplicate public key, first on line 1"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseConfigFile(strings.NewReader(test.text))
+
+		var cerr *ConfigFileError
+		if !errors.As(err, &cerr) {
+			t.Errorf("%q: want ConfigFileError, got %v", test.text, err)
+			continue
+		}
+		if want, got := test.line, cerr.Line; want != got {
+			t.Errorf("%q: want error on line %d, got %d", test.text, want, got)
+		}
+		if !strings.Contains(cerr.Error(), test.err) {
+			t.Errorf("%q: want error containing %q, got %q", test.text, test.err, cerr)
+		}
+	}
+}
@@ -4,35 +4,80 @@ import (
 	"crypto/rand"
 	"io"
 	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/benburkert/socketguard-go/message"
 	"github.com/benburkert/socketguard-go/noise"
 )
 
+const closeTimeout = time.Second
+
 type Conn struct {
+	stats stats // first for 64-bit alignment of atomic counters
+
 	net.Conn
 
 	initiator bool
 
-	version       noise.Version
-	staticPublic  noise.Key
-	staticPrivate noise.Key
-	peerPublic    noise.Key
-	presharedKey  noise.Key
+	version      noise.Version
+	staticPublic noise.Key
+	staticKey    StaticKey
+	ownedKey     *noise.PrivateKey
+	peerPublic   noise.Key
+	presharedKey noise.Key
+
+	peer *Peer
+
+	// peersMu guards peers, which Listener.Reload may replace, and
+	// authorized, set once the handshake has checked the peer
+	peersMu    sync.Mutex
+	peers      *PeerRegistry
+	authorized bool
 
 	rekeyAfter, rejectAfter time.Duration
 
-	enc  *message.Encoder
+	keyLog io.Writer
+	tracer *Tracer
+
+	enc *message.Encoder
+
+	rmu  sync.Mutex // guards the read side against Close
 	dec  *message.Decoder
 	rbuf []byte
 
-	hs handshake
+	hsMu    sync.Mutex
+	hs      handshake
+	hsStart time.Time
+	hsErr   error
+
+	wmu  writeLock
+	wmsg message.Data
+	werr error
+
+	wbufSize int
+	wdelay   time.Duration
+	wpending []byte
+	wtimer   *time.Timer
+
+	sealWorkers int
+	sealer      sealPool
+
+	onClose func(*Conn)
 
 	sending   *noise.SymmetricKey
 	receiving *noise.SymmetricKey
 }
 
+type ConnectionState struct {
+	HandshakeComplete bool
+	Version           noise.Version
+	PeerPublic        noise.Key
+	PeerName          string
+}
+
 func Client(conn net.Conn, config *Config) *Conn {
 	return newConn(conn, config, true)
 }
@@ -42,48 +87,99 @@ func Server(conn net.Conn, config *Config) *Conn {
 }
 
 func newConn(conn net.Conn, config *Config, initiator bool) *Conn {
-	var (
-		rekeyAfter, rejectAfter time.Duration
-		randReader              io.Reader
-	)
-
-	if rekeyAfter = config.RekeyAfter; rekeyAfter == 0 {
-		rekeyAfter = DefaultRekeyAfter
-	}
-	if rejectAfter = config.RejectAfter; rejectAfter == 0 {
-		rejectAfter = DefaultRejectAfter
-	}
+	var randReader io.Reader
 	if randReader = config.Rand; randReader == nil {
 		randReader = rand.Reader
 	}
 
+	staticKey, ownedKey := config.staticKey()
+
+	var precomputed *atomic.Value
+	if initiator {
+		precomputed = &config.precomputed
+	}
+
 	return &Conn{
 		Conn:      conn,
 		initiator: initiator,
 
-		version:       config.Version,
-		staticPublic:  config.StaticPublic,
-		staticPrivate: config.StaticPrivate,
-		peerPublic:    config.PeerPublic,
-		presharedKey:  config.PresharedKey,
+		version:      config.Version,
+		staticPublic: config.staticPublic(),
+		staticKey:    staticKey,
+		ownedKey:     ownedKey,
+		peerPublic:   config.PeerPublic,
+		presharedKey: config.PresharedKey,
 
-		rekeyAfter:  rekeyAfter,
-		rejectAfter: rejectAfter,
+		peers: config.Peers,
 
+		rekeyAfter:  config.rekeyAfter(),
+		rejectAfter: config.rejectAfter(),
+
+		keyLog: config.KeyLogWriter,
+		tracer: config.Tracer,
+
+		wbufSize: config.writeBufferSize(),
+		wdelay:   config.WriteDelay,
+
+		sealWorkers: config.SealWorkers,
+
+		wmu: make(writeLock, 1),
 		enc: message.NewEncoder(conn),
-		dec: message.NewDecoder(conn),
+		dec: message.NewDecoderSize(conn, config.ReadBufferSize),
 
 		hs: handshake{
-			rand: randReader,
+			rand:        randReader,
+			peers:       config.Peers,
+			precomputed: precomputed,
 		},
 	}
 }
 
 func (c *Conn) Handshake() error {
+	c.hsMu.Lock()
+	defer c.hsMu.Unlock()
+
 	if c.hs.state == handshakeFinished {
 		return nil
 	}
+	if c.hsErr != nil {
+		return c.hsErr
+	}
+
+	err := c.handshake()
+	if err == nil && c.hs.state == handshakeFinished {
+		err = c.authorize()
+	}
+	return c.handshakeResult(err)
+}
+
+// startHandshake sends a client's handshake initiation without waiting for
+// the response, which is left to the first Handshake, Read, or Write.
+func (c *Conn) startHandshake() error {
+	c.hsMu.Lock()
+	defer c.hsMu.Unlock()
+
+	if c.hs.state != handshakeZeroed || c.hsErr != nil {
+		return c.hsErr
+	}
+	return c.handshakeResult(c.sendHandshakeInitiation())
+}
+
+// handshakeResult records the outcome of a handshake step. c.hsMu must be
+// held.
+func (c *Conn) handshakeResult(err error) error {
+	if err != nil {
+		// the handshake can't be resumed, so the failure is sticky
+		c.hsErr = err
+		c.countHandshakeFailure(err)
+	}
+	if err != nil || c.hs.state == handshakeFinished {
+		c.tracer.handshakeDone(time.Since(c.hsStart), c.peerPublic, err)
+	}
+	return err
+}
 
+func (c *Conn) handshake() error {
 	if c.initiator {
 		if c.hs.state == handshakeZeroed {
 			if err := c.sendHandshakeInitiation(); err != nil {
@@ -101,7 +197,25 @@ func (c *Conn) Handshake() error {
 	return c.sendHandshakeResponse()
 }
 
+func (c *Conn) ConnectionState() ConnectionState {
+	c.hsMu.Lock()
+	defer c.hsMu.Unlock()
+
+	state := ConnectionState{
+		HandshakeComplete: c.hs.state == handshakeFinished,
+		Version:           c.hs.version,
+		PeerPublic:        c.peerPublic,
+	}
+	if c.peer != nil {
+		state.PeerName = c.peer.Name
+	}
+	return state
+}
+
 func (c *Conn) Read(b []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
 	if len(c.rbuf) > 0 {
 		return c.read(b, c.rbuf)
 	}
@@ -122,19 +236,29 @@ func (c *Conn) Read(b []byte) (int, error) {
 				return 0, ErrKeyExpired
 			}
 
-			buf, err := c.receiving.Open(nil, msg.EncryptedData)
+			buf, err := c.receiving.Open(msg.EncryptedData, msg.EncryptedData)
 			if err != nil {
+				c.countDecryptFailure()
+				c.tracer.decryptFailure(err)
 				return 0, err
 			}
+
+			record := message.HeaderSize + len(msg.EncryptedData)
+			c.countRecordReceived(record)
+			c.tracer.recordReceived(len(buf), record)
 			return c.read(b, buf)
 		case *message.HandshakeRekey:
-			err := c.hs.consumeRekey(msg, c.staticPrivate, c.staticPublic)
-			if err != nil {
+			if err := c.recvHandshakeRekey(msg); err != nil {
 				return 0, err
 			}
-
-			recvKey, _ := c.hs.beginSession()
-			c.receiving = noise.NewSymmetricKey(recvKey)
+		case *message.Alert:
+			var code [noise.AlertSize]byte
+			if _, err := c.receiving.Open(code[:0], msg.EncryptedAlert[:]); err != nil {
+				c.countDecryptFailure()
+				c.tracer.decryptFailure(err)
+				return 0, err
+			}
+			return 0, AlertError(le.Uint32(code[:]))
 		}
 	}
 }
@@ -143,31 +267,556 @@ func (c *Conn) Write(b []byte) (int, error) {
 	if err := c.Handshake(); err != nil {
 		return 0, err
 	}
-	if c.sending.Expired(c.rekeyAfter) {
-		if err := c.sendHandshakeRekey(); err != nil {
-			return 0, err
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if c.werr != nil {
+		return 0, c.werr
+	}
+	if c.wbufSize > 0 && (len(c.wpending) > 0 || len(b) < c.wbufSize) {
+		return c.writeBuffered(b)
+	}
+	return c.writeRecords(b)
+}
+
+// Flush sends any data buffered by a connection with a WriteBufferSize as a
+// single record.
+func (c *Conn) Flush() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if c.werr != nil {
+		return c.werr
+	}
+
+	c.werr = c.flush()
+	return c.werr
+}
+
+func (c *Conn) writeBuffered(b []byte) (int, error) {
+	if c.wpending == nil {
+		c.wpending = make([]byte, 0, c.wbufSize)
+	}
+
+	n := copy(c.wpending[len(c.wpending):cap(c.wpending)], b)
+	c.wpending = c.wpending[:len(c.wpending)+n]
+
+	if len(c.wpending) == cap(c.wpending) {
+		if c.werr = c.flush(); c.werr != nil {
+			return n, c.werr
 		}
 	}
 
-	msg := &message.Data{
-		EncryptedData: c.sending.Seal(nil, b),
+	// whatever did not fit is too large to coalesce, or starts a new buffer
+	if rest := b[n:]; len(rest) >= c.wbufSize {
+		m, err := c.writeRecords(rest)
+		return n + m, err
+	} else if len(rest) > 0 {
+		c.wpending = append(c.wpending, rest...)
+		n += len(rest)
+	}
+
+	if len(c.wpending) > 0 && c.wdelay > 0 && c.wtimer == nil {
+		c.wtimer = time.AfterFunc(c.wdelay, c.flushAfterDelay)
+	}
+	return n, nil
+}
+
+func (c *Conn) flushAfterDelay() {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.wtimer = nil
+	if c.werr == nil {
+		c.werr = c.flush()
+	}
+}
+
+func (c *Conn) flush() error {
+	if c.wtimer != nil {
+		c.wtimer.Stop()
+		c.wtimer = nil
+	}
+	if len(c.wpending) == 0 {
+		return nil
 	}
 
-	if err := c.enc.Encode(msg); err != nil {
+	_, err := c.writeRecords(c.wpending)
+
+	zero(c.wpending)
+	c.wpending = c.wpending[:0]
+	return err
+}
+
+// maxBatchRecords bounds the records sealed ahead of a single vectored write.
+const maxBatchRecords = 16
+
+// recordBatch tracks the sealed records queued on the encoder.
+type recordBatch struct {
+	bufs       [maxBatchRecords]*[]byte
+	plaintexts [maxBatchRecords]int
+	n          int
+}
+
+func (c *Conn) writeRecords(b []byte) (int, error) {
+	if workers := c.sealWorkers; workers > 1 && len(b) > message.MaxPlaintextSize {
+		// more workers than procs only adds scheduling overhead
+		if procs := runtime.GOMAXPROCS(0); workers > procs {
+			workers = procs
+		}
+		if workers > 1 && c.sealer.start(workers) {
+			return c.writeRecordsParallel(b)
+		}
+	}
+
+	var (
+		rb recordBatch
+
+		n, queued int
+	)
+	for {
+		p := b[n+queued:]
+		if len(p) > message.MaxPlaintextSize {
+			p = p[:message.MaxPlaintextSize]
+		}
+
+		if err := c.queueRecord(&rb, message.GetBuffer(), p); err != nil {
+			if c.flushRecords(&rb) == nil {
+				n += queued
+			}
+			return n, err
+		}
+		if queued += len(p); rb.n < maxBatchRecords && n+queued < len(b) {
+			continue
+		}
+
+		if err := c.flushRecords(&rb); err != nil {
+			return n, err
+		}
+		if n, queued = n+queued, 0; n == len(b) {
+			return n, nil
+		}
+	}
+}
+
+// writeRecordsParallel seals batches of records on the seal workers, sealing
+// the next batch while the current one is written. Each batch's nonce
+// counters are reserved up front, so the records are the same as those
+// sealed one at a time.
+func (c *Conn) writeRecordsParallel(b []byte) (int, error) {
+	var (
+		cur, next = &c.sealer.batches[0], &c.sealer.batches[1]
+
+		n, sealed int
+	)
+	for n < len(b) {
+		if cur.n == 0 {
+			if c.sending.Expired(c.rekeyAfter) {
+				if err := c.queueHandshakeRekey(); err != nil {
+					return n, err
+				}
+			}
+			sealed += c.sealBatch(cur, b[sealed:])
+		}
+
+		// a rekey must wait until the records sealed under the old key
+		// are written
+		if sealed < len(b) && !c.sending.Expired(c.rekeyAfter) {
+			sealed += c.sealBatch(next, b[sealed:])
+		}
+
+		cur.wg.Wait()
+		for i := 0; i < cur.n; i++ {
+			c.wmsg.EncryptedData = *cur.bufs[i]
+			c.enc.Queue(&c.wmsg)
+		}
+		c.wmsg.EncryptedData = nil
+
+		size := cur.size
+		if err := c.flushRecords(&cur.recordBatch); err != nil {
+			next.wg.Wait()
+			next.release()
+			return n, err
+		}
+		n += size
+		cur, next = next, cur
+	}
+	return n, nil
+}
+
+// sealBatch queues up to maxBatchRecords records from b on the seal workers
+// and returns the number of bytes queued.
+func (c *Conn) sealBatch(sb *sealBatch, b []byte) int {
+	records := (len(b) + message.MaxPlaintextSize - 1) / message.MaxPlaintextSize
+	if records > maxBatchRecords {
+		records = maxBatchRecords
+	}
+	if len(b) > records*message.MaxPlaintextSize {
+		b = b[:records*message.MaxPlaintextSize]
+	}
+
+	counter := c.sending.Reserve(uint64(records))
+
+	sb.wg.Add(records)
+	for i := 0; i < records; i++ {
+		p := b[i*message.MaxPlaintextSize:]
+		if len(p) > message.MaxPlaintextSize {
+			p = p[:message.MaxPlaintextSize]
+		}
+
+		buf := message.GetBuffer()
+		sb.bufs[i], sb.plaintexts[i] = buf, len(p)
+
+		c.sealer.jobs <- sealJob{
+			key:     c.sending,
+			buf:     buf,
+			p:       p,
+			counter: counter + uint64(i),
+			wg:      &sb.wg,
+		}
+	}
+	sb.n, sb.size = records, len(b)
+	return len(b)
+}
+
+// sealPool runs the seal workers of a conn. The workers are started by the
+// first parallel write and stopped by Close.
+type sealPool struct {
+	jobs    chan sealJob
+	closed  bool
+	batches [2]sealBatch
+}
+
+// sealBatch is a recordBatch sealed by the seal workers.
+type sealBatch struct {
+	recordBatch
+
+	wg   sync.WaitGroup
+	size int
+}
+
+type sealJob struct {
+	key     *noise.SymmetricKey
+	buf     *[]byte
+	p       []byte
+	counter uint64
+	wg      *sync.WaitGroup
+}
+
+// start starts n workers unless they are already running, and reports
+// whether workers are available.
+func (p *sealPool) start(n int) bool {
+	if p.jobs == nil && !p.closed {
+		p.jobs = make(chan sealJob, 2*maxBatchRecords)
+		for i := 0; i < n; i++ {
+			go p.work(p.jobs)
+		}
+	}
+	return p.jobs != nil
+}
+
+func (p *sealPool) stop() {
+	if p.jobs != nil {
+		close(p.jobs)
+		p.jobs = nil
+	}
+	p.closed = true
+}
+
+func (p *sealPool) work(jobs <-chan sealJob) {
+	for job := range jobs {
+		*job.buf = job.key.SealAt((*job.buf)[:0], job.p, job.counter)
+		job.wg.Done()
+	}
+}
+
+// release returns the batch's buffers to the pool without writing them.
+func (sb *sealBatch) release() {
+	for i := 0; i < sb.n; i++ {
+		message.PutBuffer(sb.bufs[i])
+		sb.bufs[i] = nil
+	}
+	sb.n = 0
+}
+
+// ReadFrom implements io.ReaderFrom. Records are read from r directly into
+// pooled buffers, sealed in place, and written in batches. A short read
+// ends the batch so interactive streams are not delayed.
+func (c *Conn) ReadFrom(r io.Reader) (int64, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	if err := c.Flush(); err != nil {
 		return 0, err
 	}
-	return len(b), nil
+
+	var (
+		bufs  [maxBatchRecords]*[]byte
+		sizes [maxBatchRecords]int
+
+		n int64
+	)
+	for {
+		// read without wmu so a source that blocks does not hold up Close
+		var (
+			k    int
+			rerr error
+		)
+		for k < maxBatchRecords && rerr == nil {
+			buf := message.GetBuffer()
+
+			var m int
+			if m, rerr = r.Read((*buf)[:message.MaxPlaintextSize]); m == 0 {
+				message.PutBuffer(buf)
+				continue
+			}
+			bufs[k], sizes[k] = buf, m
+			k++
+
+			if m < message.MaxPlaintextSize {
+				break
+			}
+		}
+
+		m, err := c.writeReadRecords(bufs[:k], sizes[:k])
+		if n += m; err != nil {
+			return n, err
+		}
+
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// writeReadRecords seals the plaintexts read into bufs in place and writes
+// them as one batch. It takes ownership of bufs.
+func (c *Conn) writeReadRecords(bufs []*[]byte, sizes []int) (int64, error) {
+	if len(bufs) == 0 {
+		return 0, nil
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	var (
+		rb recordBatch
+
+		n int64
+	)
+	for i, buf := range bufs {
+		err := c.werr
+		if err == nil {
+			err = c.queueRecord(&rb, buf, (*buf)[:sizes[i]])
+			bufs[i] = nil
+		}
+
+		if err != nil {
+			for j, buf := range bufs[i:] {
+				if buf != nil {
+					zero((*buf)[:sizes[i+j]])
+					message.PutBuffer(buf)
+				}
+			}
+			if c.flushRecords(&rb) != nil {
+				n = 0
+			}
+			return n, err
+		}
+		n += int64(sizes[i])
+	}
+
+	if err := c.flushRecords(&rb); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// queueRecord seals p into buf, which may alias p, and queues the record on
+// the encoder. The batch takes ownership of buf.
+func (c *Conn) queueRecord(rb *recordBatch, buf *[]byte, p []byte) error {
+	if c.sending.Expired(c.rekeyAfter) {
+		if err := c.queueHandshakeRekey(); err != nil {
+			message.PutBuffer(buf)
+			return err
+		}
+	}
+
+	c.wmsg.EncryptedData = c.sending.Seal((*buf)[:0], p)
+	c.enc.Queue(&c.wmsg)
+	c.wmsg.EncryptedData = nil
+
+	rb.bufs[rb.n], rb.plaintexts[rb.n] = buf, len(p)
+	rb.n++
+	return nil
+}
+
+func (c *Conn) flushRecords(rb *recordBatch) error {
+	err := c.enc.Flush()
+
+	for i := 0; i < rb.n; i++ {
+		if err == nil {
+			record := message.HeaderSize + rb.plaintexts[i] + noise.AuthTagSize
+			c.countRecordSent(record)
+			c.tracer.recordSent(rb.plaintexts[i], record)
+		}
+
+		message.PutBuffer(rb.bufs[i])
+		rb.bufs[i] = nil
+	}
+	rb.n = 0
+	return err
+}
+
+func (c *Conn) Close() error {
+	// a write blocked on the network holds wmu until the conn is closed, so
+	// buffered data is only flushed if the lock is free, and then with a
+	// deadline in case the peer stopped reading
+	var ferr error
+	locked := c.wmu.TryLock()
+	if locked {
+		if c.werr == nil && len(c.wpending) > 0 {
+			c.SetWriteDeadline(time.Now().Add(closeTimeout))
+			c.werr = c.flush()
+		}
+		ferr = c.werr
+	}
+
+	err := c.Conn.Close()
+	if err == nil {
+		err = ferr
+	}
+
+	if c.onClose != nil {
+		c.onClose(c)
+	}
+
+	if !locked {
+		c.wmu.Lock()
+	}
+	defer c.wmu.Unlock()
+
+	if c.wtimer != nil {
+		c.wtimer.Stop()
+		c.wtimer = nil
+	}
+	zero(c.wpending)
+	c.wpending = nil
+
+	c.sealer.stop()
+
+	// closing the conn unblocks a pending read
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	c.hsMu.Lock()
+	defer c.hsMu.Unlock()
+
+	c.hs.zero()
+
+	// a StaticKey from the config belongs to the caller
+	if c.ownedKey != nil {
+		*c.ownedKey = noise.PrivateKey{}
+	}
+	c.presharedKey = noise.Key{}
+
+	if c.sending != nil {
+		c.sending.Wipe()
+	}
+	if c.receiving != nil {
+		c.receiving.Wipe()
+	}
+
+	zero(c.rbuf)
+	c.rbuf = nil
+
+	return err
+}
+
+// writeLock is a mutex that Close can try to take without waiting on a write
+// blocked in the network.
+type writeLock chan struct{}
+
+func (l writeLock) Lock() { l <- struct{}{} }
+
+func (l writeLock) Unlock() { <-l }
+
+func (l writeLock) TryLock() bool {
+	select {
+	case l <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Config) writeBufferSize() int {
+	if c.WriteBufferSize > message.MaxPlaintextSize {
+		return message.MaxPlaintextSize
+	}
+	return c.WriteBufferSize
+}
+
+func (c *Conn) closeWithAlert(code AlertError) error {
+	// a write blocked on a peer that stopped reading holds wmu, so the
+	// alert is only sent if the lock is free and Close cuts off the write
+	c.SetWriteDeadline(time.Now().Add(closeTimeout))
+
+	if c.wmu.TryLock() {
+		c.hsMu.Lock()
+		finished := c.hs.state == handshakeFinished
+		c.hsMu.Unlock()
+
+		if finished {
+			var buf [noise.AlertSize]byte
+			le.PutUint32(buf[:], uint32(code))
+
+			msg := new(message.Alert)
+			c.sending.Seal(msg.EncryptedAlert[:0], buf[:])
+			c.enc.Encode(msg)
+		}
+
+		// drop buffered writes, the peer may no longer receive data
+		if c.wtimer != nil {
+			c.wtimer.Stop()
+			c.wtimer = nil
+		}
+		zero(c.wpending)
+		c.wpending = c.wpending[:0]
+		c.wmu.Unlock()
+	}
+
+	return c.Close()
+}
+
+func (c *Conn) CloseWrite() error {
+	if err := c.Flush(); err != nil {
+		return err
+	}
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return net.UnknownNetworkError(c.LocalAddr().Network())
 }
 
 func (c *Conn) read(b, buf []byte) (int, error) {
 	n := copy(b, buf)
-	if n < len(buf) {
-		c.rbuf = buf[n:]
+	zero(buf[:n])
+
+	if c.rbuf = buf[n:]; len(c.rbuf) == 0 {
+		c.rbuf = nil
 	}
 	return n, nil
 }
 
 func (c *Conn) recvHandshakeInitiation() error {
+	c.hsStart = time.Now()
+	c.tracer.handshakeStart()
+
 	msg, err := c.dec.Decode()
 	if err != nil {
 		return err
@@ -178,10 +827,19 @@ func (c *Conn) recvHandshakeInitiation() error {
 		return UnexpectedMessageError(msg.Type())
 	}
 
-	c.peerPublic, err = c.hs.consumeInitiation(hi, c.staticPrivate,
+	peerPublic, err := c.hs.consumeInitiation(hi, c.staticKey,
 		c.staticPublic)
+	if err != nil {
+		return err
+	}
 
-	return err
+	c.peerPublic = peerPublic
+	if err := c.resolvePeer(true); err != nil {
+		c.hs.zero()
+		c.hs.state = handshakeZeroed
+		return err
+	}
+	return nil
 }
 
 func (c *Conn) recvHandshakeResponse() error {
@@ -195,7 +853,7 @@ func (c *Conn) recvHandshakeResponse() error {
 		return UnexpectedMessageError(msg.Type())
 	}
 
-	if err := c.hs.consumeResponse(hr, c.staticPrivate, c.presharedKey); err != nil {
+	if err := c.hs.consumeResponse(hr, c.staticKey, c.presharedKey); err != nil {
 		return err
 	}
 
@@ -203,11 +861,21 @@ func (c *Conn) recvHandshakeResponse() error {
 	c.sending = noise.NewSymmetricKey(sendKey)
 	c.receiving = noise.NewSymmetricKey(recvKey)
 
-	return nil
+	if err := c.writeKeyLog(true, sendKey); err != nil {
+		return err
+	}
+	return c.writeKeyLog(false, recvKey)
 }
 
 func (c *Conn) sendHandshakeInitiation() error {
-	hi, err := c.hs.createInitiation(c.staticPrivate, c.staticPublic,
+	c.hsStart = time.Now()
+	c.tracer.handshakeStart()
+
+	if err := c.resolvePeer(false); err != nil {
+		return err
+	}
+
+	hi, err := c.hs.createInitiation(c.staticKey, c.staticPublic,
 		c.peerPublic, c.version)
 	if err != nil {
 		return err
@@ -216,24 +884,52 @@ func (c *Conn) sendHandshakeInitiation() error {
 	return c.enc.Encode(hi)
 }
 
+func (c *Conn) recvHandshakeRekey(msg *message.HandshakeRekey) error {
+	c.hsMu.Lock()
+	defer c.hsMu.Unlock()
+
+	if err := c.hs.consumeRekey(msg, c.staticKey, c.staticPublic); err != nil {
+		return err
+	}
+
+	recvKey, _ := c.hs.beginSession()
+	c.receiving = rotateKey(c.receiving, recvKey)
+	c.countRekeyReceived()
+	c.tracer.rekeyReceived()
+
+	return c.writeKeyLog(false, recvKey)
+}
+
 func (c *Conn) sendHandshakeRekey() error {
-	hr, err := c.hs.createRekey(c.peerPublic)
-	if err != nil {
+	if err := c.queueHandshakeRekey(); err != nil {
 		return err
 	}
+	return c.enc.Flush()
+}
 
-	if err := c.enc.Encode(hr); err != nil {
+// queueHandshakeRekey queues the rekey message on the encoder so it is
+// written in the same batch as the records sealed under the new key.
+func (c *Conn) queueHandshakeRekey() error {
+	c.hsMu.Lock()
+	defer c.hsMu.Unlock()
+
+	hr, err := c.hs.createRekey(c.peerPublic)
+	if err != nil {
 		return err
 	}
+	c.enc.Queue(hr)
 
 	sendKey, _ := c.hs.beginSession()
-	c.sending = noise.NewSymmetricKey(sendKey)
-	return nil
+	c.sending = rotateKey(c.sending, sendKey)
+	c.countRekeySent()
+	c.tracer.rekeySent()
+
+	return c.writeKeyLog(true, sendKey)
 }
 
 func (c *Conn) sendHandshakeResponse() error {
-	hr, err := c.hs.createResponse(c.staticPrivate, c.staticPublic,
-		c.peerPublic, c.presharedKey)
+	hr, err := c.hs.createResponse(c.peerPublic,
+		c.presharedKey)
 	if err != nil {
 		return err
 	}
@@ -246,5 +942,83 @@ func (c *Conn) sendHandshakeResponse() error {
 	c.receiving = noise.NewSymmetricKey(recvKey)
 	c.sending = noise.NewSymmetricKey(sendKey)
 
+	if err := c.writeKeyLog(false, recvKey); err != nil {
+		return err
+	}
+	return c.writeKeyLog(true, sendKey)
+}
+
+func (c *Conn) resolvePeer(required bool) error {
+	c.peersMu.Lock()
+	peers := c.peers
+	c.peersMu.Unlock()
+
+	if peers == nil {
+		return nil
+	}
+
+	peer, ok := peers.Lookup(c.peerPublic)
+	if !ok {
+		if required {
+			return ErrUnknownPeer
+		}
+		return nil
+	}
+
+	c.peer = peer
+	if peer.PresharedKey != (noise.Key{}) {
+		c.presharedKey = peer.PresharedKey
+	}
+	if peer.RekeyAfter != 0 {
+		c.rekeyAfter = peer.RekeyAfter
+	}
+	if peer.RejectAfter != 0 {
+		c.rejectAfter = peer.RejectAfter
+	}
+	return nil
+}
+
+// authorize marks a finished handshake for Listener.Reload, and checks a
+// server's peer against a registry reloaded while the handshake ran.
+func (c *Conn) authorize() error {
+	c.peersMu.Lock()
+	defer c.peersMu.Unlock()
+
+	if !c.initiator && c.peers != nil {
+		if _, ok := c.peers.Lookup(c.peerPublic); !ok {
+			return ErrUnknownPeer
+		}
+	}
+	c.authorized = true
 	return nil
 }
+
+// reload replaces the conn's peer registry. A conn that finished its
+// handshake is closed with a revocation alert if its peer is missing; one
+// still handshaking is checked by authorize.
+func (c *Conn) reload(peers *PeerRegistry) {
+	c.peersMu.Lock()
+	c.peers = peers
+	authorized := c.authorized
+	c.peersMu.Unlock()
+
+	if !authorized || peers == nil {
+		return
+	}
+	if _, ok := peers.Lookup(c.peerPublic); !ok {
+		go c.closeWithAlert(AlertRevoked)
+	}
+}
+
+func rotateKey(old *noise.SymmetricKey, key noise.Key) *noise.SymmetricKey {
+	if old != nil {
+		old.Wipe()
+	}
+	return noise.NewSymmetricKey(key)
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
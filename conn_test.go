@@ -1,12 +1,23 @@
 package socketguard
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/benburkert/socketguard-go/internal/must"
+	"github.com/benburkert/socketguard-go/message"
+	"github.com/benburkert/socketguard-go/noise"
 )
 
 var (
@@ -87,6 +98,163 @@ func TestGoConn(t *testing.T) {
 	}
 }
 
+func TestConnClose(t *testing.T) {
+	cliConf, srvConf := mustConfigPair()
+	cliConf.PresharedKey = must.GenerateKey()
+	srvConf.PresharedKey = cliConf.PresharedKey
+
+	cliNet, srvNet := net.Pipe()
+	cli, srv := Client(cliNet, cliConf), Server(srvNet, srvConf)
+	defer srv.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := srv.Write([]byte("ping!"))
+		errc <- err
+	}()
+
+	for _, want := range []string{"pi", "n"} {
+		buf := make([]byte, len(want))
+		if _, err := io.ReadFull(cli, buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf); want != got {
+			t.Fatalf("want read %q, got %q", want, got)
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := (noise.Key{}), cli.hs.ephemeralPrivate; want != got {
+		t.Errorf("want ephemeral private key wiped after handshake, got %x", got[:])
+	}
+	if want, got := (noise.HashSum{}), cli.hs.chainingKey; want != got {
+		t.Errorf("want chaining key wiped after handshake, got %x", got[:])
+	}
+
+	if want, got := (ConnectionState{HandshakeComplete: true, PeerPublic: cliConf.StaticPublic}), srv.ConnectionState(); want != got {
+		t.Errorf("want server connection state %+v, got %+v", want, got)
+	}
+	if want, got := (ConnectionState{HandshakeComplete: true, PeerPublic: srvConf.StaticPublic}), cli.ConnectionState(); want != got {
+		t.Errorf("want client connection state %+v, got %+v", want, got)
+	}
+
+	rbuf := cli.rbuf
+	if want, got := "g!", string(rbuf); want != got {
+		t.Fatalf("want buffered plaintext %q, got %q", want, got)
+	}
+
+	sending, receiving := cli.sending, cli.receiving
+	if err := cli.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := (handshake{rand: cli.hs.rand, peers: cli.hs.peers, state: handshakeFinished}), cli.hs; want != got {
+		t.Errorf("want zeroed handshake, got %+v", got)
+	}
+	if want, got := (noise.SymmetricKey{}), *sending; want != got {
+		t.Errorf("want zeroed sending key, got %+v", got)
+	}
+	if want, got := (noise.SymmetricKey{}), *receiving; want != got {
+		t.Errorf("want zeroed receiving key, got %+v", got)
+	}
+	if want, got := (noise.PrivateKey{}), *cli.staticKey.(*noise.PrivateKey); want != got {
+		t.Errorf("want zeroed static private key, got %x", got[:])
+	}
+	if want, got := (noise.Key{}), cli.presharedKey; want != got {
+		t.Errorf("want zeroed preshared key, got %x", got[:])
+	}
+	if want, got := make([]byte, len(rbuf)), rbuf; !bytes.Equal(want, got) {
+		t.Errorf("want zeroed plaintext buffer, got %x", got)
+	}
+	if cli.rbuf != nil {
+		t.Errorf("want nil plaintext buffer, got %x", cli.rbuf)
+	}
+}
+
+func TestConnCloseStaticKey(t *testing.T) {
+	cliConf, srvConf := mustConfigPair()
+
+	priv := noise.PrivateKey(cliConf.StaticPrivate)
+	cliConf.StaticKey, cliConf.StaticPrivate = &priv, noise.Key{}
+	cliConf.PreferGo, srvConf.PreferGo = true, true
+
+	for i := 0; i < 2; i++ {
+		cli, srv := mustConnPairConfig(t, cliConf, srvConf)
+		if err := cli.Close(); err != nil {
+			t.Fatal(err)
+		}
+		srv.Close()
+
+		if (priv == noise.PrivateKey{}) {
+			t.Fatal("want config StaticKey left intact by Close")
+		}
+	}
+}
+
+func TestConnCloseBlockedWrite(t *testing.T) {
+	cli, srv := mustConnPair(t)
+	defer srv.Close()
+
+	// the server never reads, so the write blocks on the pipe
+	errc := make(chan error, 1)
+	go func() {
+		_, err := cli.Write(make([]byte, 100))
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	closec := make(chan error, 1)
+	go func() { closec <- cli.Close() }()
+
+	select {
+	case <-closec:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want Close to unblock a pending write")
+	}
+	if err := <-errc; err == nil {
+		t.Error("want blocked write to fail after Close")
+	}
+}
+
+func TestConnCloseConcurrentRead(t *testing.T) {
+	cli, srv := mustConnPair(t)
+	defer srv.Close()
+
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			if _, err := srv.Write(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	donec := make(chan struct{})
+	go func() {
+		defer close(donec)
+
+		buf := make([]byte, 64)
+		for {
+			if _, err := cli.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := cli.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-donec:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want Close to unblock a pending read")
+	}
+}
+
 func mustConfigPair() (cli, srv *Config) {
 	srv, cli = new(Config), new(Config)
 	srv.StaticPrivate, srv.StaticPublic = must.GenerateKeyPair()
@@ -94,3 +262,808 @@ func mustConfigPair() (cli, srv *Config) {
 	cli.PeerPublic = srv.StaticPublic
 	return
 }
+
+func TestConnKeyLog(t *testing.T) {
+	var cliLog, srvLog bytes.Buffer
+
+	cliConf, srvConf := mustConfigPair()
+	cliConf.KeyLogWriter, srvConf.KeyLogWriter = &cliLog, &srvLog
+
+	cliNet, srvNet := net.Pipe()
+	cli, srv := Client(cliNet, cliConf), Server(srvNet, srvConf)
+	defer cli.Close()
+	defer srv.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		if err := cli.Handshake(); err != nil {
+			errc <- err
+			return
+		}
+
+		initKey := cli.sending.Key
+		if err := cli.sendHandshakeRekey(); err != nil {
+			errc <- err
+			return
+		}
+
+		line := fmt.Sprintf("%s %x %x %x", keyLogLabelInitiator, cli.hs.hash[:],
+			cli.hs.sessionEphemeral[:], cli.sending.Key[:])
+		if want, got := line, lastLine(cliLog.String()); want != got {
+			errc <- fmt.Errorf("want rekey log line %q, got %q", want, got)
+			return
+		}
+		if !bytes.Contains(cliLog.Bytes(), []byte(fmt.Sprintf("%x\n", initKey[:]))) {
+			errc <- fmt.Errorf("want initial key %x logged, got %q", initKey[:], cliLog.String())
+			return
+		}
+
+		_, err := cli.Write([]byte("ping!"))
+		errc <- err
+	}()
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(srv, buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := cliLog.String(), srvLog.String(); len(want) == 0 || !sameLines(want, got) {
+		t.Errorf("want matching key logs, got client log %q, server log %q", want, got)
+	}
+	if want, got := 3, strings.Count(cliLog.String(), "\n"); want != got {
+		t.Errorf("want %d key log lines, got %d", want, got)
+	}
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return lines[len(lines)-1]
+}
+
+func sameLines(a, b string) bool {
+	as, bs := strings.Split(a, "\n"), strings.Split(b, "\n")
+	sort.Strings(as)
+	sort.Strings(bs)
+	return reflect.DeepEqual(as, bs)
+}
+
+func TestConnTracer(t *testing.T) {
+	type events struct {
+		handshakeStart, handshakeDone int
+		rekeySent, rekeyReceived      int
+		decryptFailure                int
+		recordSent, recordReceived    int
+		bytesSent, bytesReceived      int
+		peer                          noise.Key
+		err                           error
+	}
+
+	tracer := func(ev *events) *Tracer {
+		return &Tracer{
+			HandshakeStart: func() { ev.handshakeStart++ },
+			HandshakeDone: func(elapsed time.Duration, peer noise.Key, err error) {
+				ev.handshakeDone++
+				ev.peer, ev.err = peer, err
+			},
+			RekeySent:      func() { ev.rekeySent++ },
+			RekeyReceived:  func() { ev.rekeyReceived++ },
+			DecryptFailure: func(error) { ev.decryptFailure++ },
+			RecordSent: func(plaintext, record int) {
+				ev.recordSent++
+				ev.bytesSent += record
+			},
+			RecordReceived: func(plaintext, record int) {
+				ev.recordReceived++
+				ev.bytesReceived += record
+			},
+		}
+	}
+
+	var cliEvents, srvEvents events
+
+	cliConf, srvConf := mustConfigPair()
+	cliConf.Tracer, srvConf.Tracer = tracer(&cliEvents), tracer(&srvEvents)
+
+	cliNet, srvNet := net.Pipe()
+	cli, srv := Client(cliNet, cliConf), Server(srvNet, srvConf)
+	defer cli.Close()
+	defer srv.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		if _, err := cli.Write([]byte("ping!")); err != nil {
+			errc <- err
+			return
+		}
+		if err := cli.sendHandshakeRekey(); err != nil {
+			errc <- err
+			return
+		}
+		if _, err := cli.Write([]byte("ping!")); err != nil {
+			errc <- err
+			return
+		}
+
+		errc <- cli.enc.Encode(&message.Data{
+			EncryptedData: must.RandBytes(5 + noise.AuthTagSize),
+		})
+	}()
+
+	buf := make([]byte, 10)
+	if _, err := io.ReadFull(srv, buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.Read(buf); err == nil {
+		t.Fatal("want decrypt error")
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	recordLen := message.HeaderSize + 5 + noise.AuthTagSize
+	if want, got := (events{
+		handshakeStart: 1,
+		handshakeDone:  1,
+		rekeySent:      1,
+		recordSent:     2,
+		bytesSent:      2 * recordLen,
+		peer:           srvConf.StaticPublic,
+	}), cliEvents; want != got {
+		t.Errorf("want client events %+v, got %+v", want, got)
+	}
+	if want, got := (events{
+		handshakeStart: 1,
+		handshakeDone:  1,
+		rekeyReceived:  1,
+		decryptFailure: 1,
+		recordReceived: 2,
+		bytesReceived:  2 * recordLen,
+		peer:           cliConf.StaticPublic,
+	}), srvEvents; want != got {
+		t.Errorf("want server events %+v, got %+v", want, got)
+	}
+}
+
+func TestConnStats(t *testing.T) {
+	cliConf, srvConf := mustConfigPair()
+
+	cliNet, srvNet := net.Pipe()
+	cli, srv := Client(cliNet, cliConf), Server(srvNet, srvConf)
+	defer cli.Close()
+	defer srv.Close()
+
+	total := TotalStats()
+
+	errc := make(chan error, 1)
+	go func() {
+		if _, err := cli.Write([]byte("ping!")); err != nil {
+			errc <- err
+			return
+		}
+		if err := cli.sendHandshakeRekey(); err != nil {
+			errc <- err
+			return
+		}
+		if _, err := cli.Write([]byte("ping!")); err != nil {
+			errc <- err
+			return
+		}
+
+		errc <- cli.enc.Encode(&message.Data{
+			EncryptedData: must.RandBytes(5 + noise.AuthTagSize),
+		})
+	}()
+
+	buf := make([]byte, 10)
+	if _, err := io.ReadFull(srv, buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.Read(buf); err == nil {
+		t.Fatal("want decrypt error")
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	recordLen := uint64(message.HeaderSize + 5 + noise.AuthTagSize)
+
+	cliStats := cli.Stats()
+	if want, got := 2*recordLen, cliStats.BytesSent; want != got {
+		t.Errorf("want %d bytes sent, got %d", want, got)
+	}
+	if want, got := uint64(2), cliStats.RecordsSent; want != got {
+		t.Errorf("want %d records sent, got %d", want, got)
+	}
+	if want, got := uint64(1), cliStats.RekeysSent; want != got {
+		t.Errorf("want %d rekeys sent, got %d", want, got)
+	}
+
+	srvStats := srv.Stats()
+	if want, got := 2*recordLen, srvStats.BytesReceived; want != got {
+		t.Errorf("want %d bytes received, got %d", want, got)
+	}
+	if want, got := uint64(2), srvStats.RecordsReceived; want != got {
+		t.Errorf("want %d records received, got %d", want, got)
+	}
+	if want, got := uint64(1), srvStats.RekeysReceived; want != got {
+		t.Errorf("want %d rekeys received, got %d", want, got)
+	}
+	if want, got := uint64(1), srvStats.DecryptFailures; want != got {
+		t.Errorf("want %d decrypt failures, got %d", want, got)
+	}
+
+	if got := TotalStats(); got.DecryptFailures < total.DecryptFailures+1 ||
+		got.RecordsSent < total.RecordsSent+2 {
+		t.Errorf("want process totals to include connection stats, got %+v", got)
+	}
+
+	cliNet, srvNet = net.Pipe()
+	srv = Server(srvNet, srvConf)
+	defer srv.Close()
+
+	go func() {
+		errc <- message.NewEncoder(cliNet).Encode(&message.Data{})
+	}()
+
+	if _, err := srv.Read(buf); err == nil {
+		t.Fatal("want handshake error")
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := uint64(1), srv.Stats().HandshakeFailures["unexpected_message"]; want != got {
+		t.Errorf("want %d unexpected message handshake failures, got %d", want, got)
+	}
+}
+
+func TestConnLargeWrite(t *testing.T) {
+	cli, srv := mustConnPair(t)
+	defer cli.Close()
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	cli.enc, srv.dec = message.NewEncoder(&buf), message.NewDecoder(&buf)
+
+	want := must.RandBytes(2*message.MaxPlaintextSize + 1)
+	if n, err := cli.Write(want); err != nil {
+		t.Fatal(err)
+	} else if n != len(want) {
+		t.Fatalf("want %d bytes written, got %d", len(want), n)
+	}
+	if want, got := uint64(3), cli.Stats().RecordsSent; want != got {
+		t.Errorf("want %d records, got %d", want, got)
+	}
+
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(srv, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Error("want large write to round trip")
+	}
+}
+
+func TestConnReadFrom(t *testing.T) {
+	cli, srv := mustConnPair(t)
+	defer cli.Close()
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	cli.enc, srv.dec = message.NewEncoder(&buf), message.NewDecoder(&buf)
+
+	want := must.RandBytes(20*message.MaxPlaintextSize + 1)
+
+	// hide bytes.Reader's WriterTo so io.Copy uses Conn.ReadFrom
+	r := struct{ io.Reader }{bytes.NewReader(want)}
+	if n, err := io.Copy(cli, r); err != nil {
+		t.Fatal(err)
+	} else if n != int64(len(want)) {
+		t.Fatalf("want %d bytes copied, got %d", len(want), n)
+	}
+	if want, got := uint64(21), cli.Stats().RecordsSent; want != got {
+		t.Errorf("want %d records, got %d", want, got)
+	}
+
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(srv, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Error("want copied data to round trip")
+	}
+}
+
+func TestConnReadFromClose(t *testing.T) {
+	cli, srv := mustConnPair(t)
+	defer srv.Close()
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	// the source never produces data, so ReadFrom blocks reading it
+	go cli.ReadFrom(pr)
+	time.Sleep(10 * time.Millisecond)
+
+	closec := make(chan error, 1)
+	go func() { closec <- cli.Close() }()
+
+	select {
+	case <-closec:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want Close while ReadFrom is blocked on its source")
+	}
+}
+
+func TestConnSealWorkers(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	cli, srv := mustConnPair(t)
+	defer cli.Close()
+	defer srv.Close()
+
+	key, counter := cli.sending.Key, cli.sending.Counter
+
+	want := must.RandBytes(40*message.MaxPlaintextSize + 7)
+
+	var seq, par bytes.Buffer
+	cli.enc = message.NewEncoder(&seq)
+	if _, err := cli.Write(want); err != nil {
+		t.Fatal(err)
+	}
+
+	cli.sending = noise.NewSymmetricKey(key)
+	cli.sending.Counter = counter
+	cli.sealWorkers = 4
+	cli.enc = message.NewEncoder(&par)
+	if n, err := cli.Write(want); err != nil {
+		t.Fatal(err)
+	} else if n != len(want) {
+		t.Fatalf("want %d bytes written, got %d", len(want), n)
+	}
+
+	if !bytes.Equal(seq.Bytes(), par.Bytes()) {
+		t.Fatal("want parallel records to match sequential records")
+	}
+	if want, got := uint64(2*41), cli.Stats().RecordsSent; want != got {
+		t.Errorf("want %d records, got %d", want, got)
+	}
+
+	srv.dec = message.NewDecoder(&par)
+
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(srv, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Error("want parallel write to round trip")
+	}
+}
+
+func TestConnSealWorkersRekey(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	cli, srv := mustConnPair(t)
+	defer cli.Close()
+	defer srv.Close()
+
+	// keys expire as soon as the timestamp advances
+	cli.rekeyAfter = time.Nanosecond
+	cli.sealWorkers = 4
+
+	var buf bytes.Buffer
+	cli.enc, srv.dec = message.NewEncoder(&buf), message.NewDecoder(&buf)
+
+	want := must.RandBytes(40*message.MaxPlaintextSize + 7)
+	if _, err := cli.Write(want); err != nil {
+		t.Fatal(err)
+	}
+	if cli.Stats().RekeysSent == 0 {
+		t.Error("want rekey during parallel write")
+	}
+
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(srv, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Error("want rekeyed parallel write to round trip")
+	}
+}
+
+func TestConnWriteBuffer(t *testing.T) {
+	cliConf, srvConf := mustConfigPair()
+	cliConf.WriteBufferSize = 16
+
+	cli, srv := mustConnPairConfig(t, cliConf, srvConf)
+	defer srv.Close()
+
+	var buf lockedBuffer
+	cli.enc, srv.dec = message.NewEncoder(&buf), message.NewDecoder(&buf)
+
+	for _, p := range []string{"a", "b", "c"} {
+		if _, err := cli.Write([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want, got := uint64(0), cli.Stats().RecordsSent; want != got {
+		t.Errorf("want %d records before flush, got %d", want, got)
+	}
+	if err := cli.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := uint64(1), cli.Stats().RecordsSent; want != got {
+		t.Errorf("want %d records after flush, got %d", want, got)
+	}
+
+	// a full buffer is sent without a flush
+	for _, p := range []string{"0123456789", "abcdefXY"} {
+		if _, err := cli.Write([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want, got := uint64(2), cli.Stats().RecordsSent; want != got {
+		t.Errorf("want %d records after filling the buffer, got %d", want, got)
+	}
+
+	if err := cli.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := uint64(3), cli.Stats().RecordsSent; want != got {
+		t.Errorf("want %d records after close, got %d", want, got)
+	}
+
+	got := make([]byte, 21)
+	if _, err := io.ReadFull(srv, got); err != nil {
+		t.Fatal(err)
+	}
+	if want := "abc0123456789abcdefXY"; want != string(got) {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	cliConf, srvConf = mustConfigPair()
+	cliConf.WriteBufferSize, cliConf.WriteDelay = 1024, 10*time.Millisecond
+
+	cli, srv = mustConnPairConfig(t, cliConf, srvConf)
+	defer cli.Close()
+	defer srv.Close()
+
+	cli.enc, srv.dec = message.NewEncoder(&buf), message.NewDecoder(&buf)
+
+	// writes at least as large as the buffer bypass it
+	large := make([]byte, 2048)
+	if _, err := cli.Write(large); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := uint64(1), cli.Stats().RecordsSent; want != got {
+		t.Errorf("want %d records after a large write, got %d", want, got)
+	}
+	if _, err := io.ReadFull(srv, large); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cli.Write([]byte("ping!")); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); cli.Stats().RecordsSent == 1; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("want buffered write flushed after WriteDelay")
+		}
+	}
+	if _, err := io.ReadFull(srv, got[:5]); err != nil {
+		t.Fatal(err)
+	}
+	if want := "ping!"; want != string(got[:5]) {
+		t.Errorf("want %q, got %q", want, got[:5])
+	}
+}
+
+func TestConnWriteBufferLarge(t *testing.T) {
+	cliConf, srvConf := mustConfigPair()
+	cliConf.WriteBufferSize = 64
+
+	cli, srv := mustConnPairConfig(t, cliConf, srvConf)
+	defer cli.Close()
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	cli.enc, srv.dec = message.NewEncoder(&buf), message.NewDecoder(&buf)
+
+	// a large write behind pending data tops up the buffer, then bypasses it
+	want := append([]byte("a"), must.RandBytes(64<<10)...)
+	if _, err := cli.Write(want[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := cli.Write(want[1:]); err != nil {
+		t.Fatal(err)
+	} else if n != len(want)-1 {
+		t.Fatalf("want %d bytes written, got %d", len(want)-1, n)
+	}
+	if want, got := uint64(5), cli.Stats().RecordsSent; want != got {
+		t.Errorf("want %d records, got %d", want, got)
+	}
+
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(srv, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Error("want buffered and large writes to round trip")
+	}
+}
+
+type lockedBuffer struct {
+	mu sync.Mutex
+	bytes.Buffer
+}
+
+func (b *lockedBuffer) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.Read(p)
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func BenchmarkConn(b *testing.B) {
+	for _, size := range []int{64, 1024, message.MaxPlaintextSize} {
+		size := size
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			cli, srv := mustConnPair(b)
+			defer cli.Close()
+			defer srv.Close()
+
+			var buf bytes.Buffer
+			cli.enc, srv.dec = message.NewEncoder(&buf), message.NewDecoder(&buf)
+
+			wbuf, rbuf := make([]byte, size), make([]byte, size)
+
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := cli.Write(wbuf); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.ReadFull(srv, rbuf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func mustConnPair(tb testing.TB) (cli, srv *Conn) {
+	tb.Helper()
+
+	cliConf, srvConf := mustConfigPair()
+	return mustConnPairConfig(tb, cliConf, srvConf)
+}
+
+func mustConnPairConfig(tb testing.TB, cliConf, srvConf *Config) (cli, srv *Conn) {
+	tb.Helper()
+
+	cliNet, srvNet := net.Pipe()
+	cli, srv = Client(cliNet, cliConf), Server(srvNet, srvConf)
+
+	errc := make(chan error, 1)
+	go func() { errc <- cli.Handshake() }()
+
+	if err := srv.Handshake(); err != nil {
+		tb.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		tb.Fatal(err)
+	}
+	return cli, srv
+}
+
+func TestConnReadBuffer(t *testing.T) {
+	ctx := context.Background()
+
+	cliConf, srvConf := mustConfigPair()
+	cliConf.PreferGo, srvConf.PreferGo = true, true
+	cliConf.ReadBufferSize = 4096
+
+	ln, err := Listen(ctx, "tcp", "127.0.0.1:0", srvConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer conn.Close()
+
+		// the response and data records arrive together, so the client
+		// reads the first Data records ahead while handshaking
+		for _, msg := range []string{"one", "two", "three"} {
+			if _, err := conn.Write([]byte(msg)); err != nil {
+				errc <- err
+				return
+			}
+		}
+		errc <- nil
+	}()
+
+	cli, err := Dial(ctx, "tcp", ln.Addr().String(), cliConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadAll(cli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "onetwothree"; want != string(got) {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func BenchmarkConnLoopback(b *testing.B) {
+	for _, size := range []int{0, 4096, 65536} {
+		size := size
+		b.Run(fmt.Sprintf("readbuf=%d", size), func(b *testing.B) {
+			ctx := context.Background()
+
+			cliConf, srvConf := mustConfigPair()
+			cliConf.PreferGo, srvConf.PreferGo = true, true
+			srvConf.ReadBufferSize = size
+
+			ln, err := Listen(ctx, "tcp", "127.0.0.1:0", srvConf)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer ln.Close()
+
+			cli, err := Dial(ctx, "tcp", ln.Addr().String(), cliConf)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer cli.Close()
+
+			srv, err := ln.Accept()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer srv.Close()
+
+			const record = 64
+			if err := srv.(*Conn).Handshake(); err != nil {
+				b.Fatal(err)
+			}
+
+			errc := make(chan error, 1)
+			go func() {
+				buf := make([]byte, record)
+				for i := 0; i < b.N; i++ {
+					if _, err := cli.Write(buf); err != nil {
+						errc <- err
+						return
+					}
+				}
+				errc <- nil
+			}()
+
+			b.ReportAllocs()
+			b.SetBytes(record)
+			b.ResetTimer()
+
+			buf := make([]byte, record)
+			for i := 0; i < b.N; i++ {
+				if _, err := io.ReadFull(srv, buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := <-errc; err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+func BenchmarkConnReadFrom(b *testing.B) {
+	ctx := context.Background()
+
+	cliConf, srvConf := mustConfigPair()
+	cliConf.PreferGo, srvConf.PreferGo = true, true
+
+	ln, err := Listen(ctx, "tcp", "127.0.0.1:0", srvConf)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ln.Close()
+
+	cli, err := Dial(ctx, "tcp", ln.Addr().String(), cliConf)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer cli.Close()
+
+	srv, err := ln.Accept()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer srv.Close()
+
+	const chunk = 1 << 20
+	src := make([]byte, chunk)
+
+	for _, name := range []string{"Write", "ReadFrom"} {
+		name := name
+		b.Run(name, func(b *testing.B) {
+			errc := make(chan error, 1)
+			go func() {
+				_, err := io.CopyN(ioutil.Discard, srv, int64(b.N)*chunk)
+				errc <- err
+			}()
+
+			b.ReportAllocs()
+			b.SetBytes(chunk)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				var err error
+				if name == "Write" {
+					_, err = cli.Write(src)
+				} else {
+					_, err = cli.(*Conn).ReadFrom(bytes.NewReader(src))
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := <-errc; err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+// BenchmarkConnSealWorkers compares sealing on one goroutine against
+// SealWorkers set to GOMAXPROCS. Run it with -cpu 1,2,4,8 to see scaling.
+func BenchmarkConnSealWorkers(b *testing.B) {
+	const size = 1 << 20
+
+	for _, name := range []string{"sequential", "parallel"} {
+		name := name
+		b.Run(name, func(b *testing.B) {
+			cli, srv := mustConnPair(b)
+			defer cli.Close()
+			defer srv.Close()
+
+			cli.enc = message.NewEncoder(ioutil.Discard)
+			if name == "parallel" {
+				cli.sealWorkers = runtime.GOMAXPROCS(0)
+			}
+
+			buf := make([]byte, size)
+
+			b.ReportAllocs()
+			b.SetBytes(size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := cli.Write(buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
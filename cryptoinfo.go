@@ -0,0 +1,83 @@
+package socketguard
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+// The crypto info passed to the kernel module is a packed little-endian
+// struct prefixed by a version and size header, so the module can reject
+// layouts it does not understand and new fields can be appended:
+//
+//	u16 info version
+//	u16 info size (including header)
+//	u16 min version
+//	u16 max version
+//	[32]byte static public
+//	[32]byte static private
+//	[32]byte peer public
+//	[32]byte preshared key
+//	u64 rekey after (nanoseconds)
+//	u64 reject after (nanoseconds)
+const (
+	cryptoInfoVersion1 = 1
+
+	cryptoInfoHeaderSize = 4
+	cryptoInfoSizeV1     = cryptoInfoHeaderSize + 4 + 4*noise.KeySize + 8 + 8
+)
+
+var le = binary.LittleEndian
+
+type cryptoInfo struct {
+	minVersion uint16
+	maxVersion uint16
+
+	staticPublic  noise.Key
+	staticPrivate noise.Key
+	peerPublic    noise.Key
+	presharedKey  noise.Key
+
+	rekeyAfter  time.Duration
+	rejectAfter time.Duration
+}
+
+func (c *Config) cryptoInfo() cryptoInfo {
+	return cryptoInfo{
+		minVersion:    c.Version.Min(),
+		maxVersion:    c.Version.Max(),
+		staticPublic:  c.staticPublic(),
+		staticPrivate: c.StaticPrivate,
+		peerPublic:    c.PeerPublic,
+		presharedKey:  c.PresharedKey,
+		rekeyAfter:    c.rekeyAfter(),
+		rejectAfter:   c.rejectAfter(),
+	}
+}
+
+func (i *cryptoInfo) pack(b []byte) []byte {
+	var buf [cryptoInfoSizeV1]byte
+
+	le.PutUint16(buf[0:], cryptoInfoVersion1)
+	le.PutUint16(buf[2:], cryptoInfoSizeV1)
+	le.PutUint16(buf[4:], i.minVersion)
+	le.PutUint16(buf[6:], i.maxVersion)
+
+	off := 8
+	for _, key := range []*noise.Key{
+		&i.staticPublic,
+		&i.staticPrivate,
+		&i.peerPublic,
+		&i.presharedKey,
+	} {
+		off += copy(buf[off:], key[:])
+	}
+
+	le.PutUint64(buf[off:], uint64(i.rekeyAfter))
+	le.PutUint64(buf[off+8:], uint64(i.rejectAfter))
+
+	b = append(b, buf[:]...)
+	zero(buf[:])
+	return b
+}
@@ -0,0 +1,92 @@
+package socketguard
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/benburkert/socketguard-go/internal/must"
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+func TestCryptoInfoPack(t *testing.T) {
+	var (
+		sPub = noise.Key{0x01, 0x02, 0x03}
+		sKey = noise.Key{0x04, 0x05, 0x06}
+		rPub = noise.Key{0x07, 0x08, 0x09}
+		psk  = noise.Key{0x0a, 0x0b, 0x0c}
+
+		zeroPub = noise.PrivateKey{}.Public()
+	)
+
+	tests := []struct {
+		name string
+
+		config *Config
+
+		buf []byte
+	}{
+		{
+			name: "zero-value",
+
+			config: &Config{},
+
+			buf: must.Bytes(
+				uint16(cryptoInfoVersion1),
+				uint16(cryptoInfoSizeV1),
+				uint16(0), uint16(0),
+				zeroPub[:],
+				make([]byte, noise.KeySize),
+				make([]byte, noise.KeySize),
+				make([]byte, noise.KeySize),
+				uint64(DefaultRekeyAfter),
+				uint64(DefaultRejectAfter),
+			),
+		},
+		{
+			name: "happy-path",
+
+			config: &Config{
+				Version:       noise.NewVersion(1, 2),
+				StaticPublic:  sPub,
+				StaticPrivate: sKey,
+				PeerPublic:    rPub,
+				PresharedKey:  psk,
+				RekeyAfter:    time.Second,
+				RejectAfter:   time.Minute,
+			},
+
+			buf: must.Bytes(
+				// header
+				byte(0x01), byte(0x00),
+				byte(0x98), byte(0x00),
+				// versions
+				byte(0x01), byte(0x00),
+				byte(0x02), byte(0x00),
+				// keys
+				sPub[:], sKey[:], rPub[:], psk[:],
+				// rekey after
+				[]byte{0x00, 0xca, 0x9a, 0x3b, 0x00, 0x00, 0x00, 0x00},
+				// reject after
+				[]byte{0x00, 0x58, 0x47, 0xf8, 0x0d, 0x00, 0x00, 0x00},
+			),
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			info := test.config.cryptoInfo()
+			buf := info.pack(nil)
+
+			if want, got := cryptoInfoSizeV1, len(buf); want != got {
+				t.Errorf("want %d packed bytes, got %d", want, got)
+			}
+			if want, got := test.buf, buf; !bytes.Equal(want, got) {
+				t.Errorf("want packed bytes %x, got %x", want, got)
+			}
+		})
+	}
+}
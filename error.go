@@ -10,6 +10,15 @@ import (
 var (
 	ErrKeyExpired  = errors.New("socketguard: receiving key expired")
 	ErrRekeyFailed = errors.New("socketguard: rekey failed")
+
+	ErrUnsupportedInfo = errors.New("socketguard: unsupported kernel info format")
+
+	ErrKeyMismatch      = errors.New("socketguard: static public key does not match private key")
+	ErrMissingPeerKey   = errors.New("socketguard: peer public key required")
+	ErrMissingStaticKey = errors.New("socketguard: static private key required")
+	ErrUnknownPeer      = errors.New("socketguard: unknown peer")
+
+	ErrStaticKeyRequiresGo = errors.New("socketguard: StaticKey requires PreferGo")
 )
 
 type UnexpectedMessageError message.Type
@@ -17,3 +26,16 @@ type UnexpectedMessageError message.Type
 func (e UnexpectedMessageError) Error() string {
 	return fmt.Sprintf("socketguard: unexpected message type: %d", e)
 }
+
+type AlertError uint32
+
+const AlertRevoked AlertError = 1
+
+func (e AlertError) Error() string {
+	switch e {
+	case AlertRevoked:
+		return "socketguard: peer sent alert: revoked"
+	default:
+		return fmt.Sprintf("socketguard: peer sent alert: %d", uint32(e))
+	}
+}
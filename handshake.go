@@ -2,6 +2,7 @@ package socketguard
 
 import (
 	"io"
+	"sync/atomic"
 
 	"github.com/benburkert/socketguard-go/message"
 	"github.com/benburkert/socketguard-go/noise"
@@ -26,13 +27,19 @@ const (
 )
 
 type handshake struct {
-	rand io.Reader
+	rand  io.Reader
+	peers *PeerRegistry
+
+	// precomputed caches the static-static DH result with the peer a
+	// client dials, across the conns of a Config.
+	precomputed *atomic.Value
 
 	state handshakeState
 
 	version          noise.Version
 	ephemeralPrivate noise.Key
 	remoteEphemeral  noise.Key
+	sessionEphemeral noise.Key
 	remoteTimestamp  noise.Timestamp
 	staticStatic     noise.Key
 
@@ -43,7 +50,7 @@ type handshake struct {
 	recvRekey noise.HashSum
 }
 
-func (h *handshake) createInitiation(sPriv, sPub, rs noise.Key, version noise.Version) (*message.HandshakeInitiation, error) {
+func (h *handshake) createInitiation(static StaticKey, sPub, rs noise.Key, version noise.Version) (*message.HandshakeInitiation, error) {
 	var (
 		msg message.HandshakeInitiation
 
@@ -65,7 +72,9 @@ func (h *handshake) createInitiation(sPriv, sPub, rs noise.Key, version noise.Ve
 	chainingKey.MixKDF1(ePub[:])
 
 	/* es */
-	key = chainingKey.MixDH(ePriv, rs)
+	if key, err = chainingKey.MixDH(ePriv, rs); err != nil {
+		return nil, err
+	}
 
 	/* version */
 	msg.EncryptedVersion = hash.MixSealVersion(key, version)
@@ -75,23 +84,28 @@ func (h *handshake) createInitiation(sPriv, sPub, rs noise.Key, version noise.Ve
 	msg.EncryptedStatic = hash.MixSealKey(key, sPub)
 
 	/* ss */
-	ss := sPriv.SharedSecret(rs)
+	ss, err := h.computeStaticStatic(static, sPub, rs)
+	if err != nil {
+		return nil, err
+	}
 	key = chainingKey.MixKey(ss)
 
 	h.chainingKey = chainingKey
 	h.hash = hash
 	h.ephemeralPrivate = ePriv
+	h.sessionEphemeral = ePub
 	h.staticStatic = ss
 	h.state = handshakeInitiated
 
 	return &msg, nil
 }
 
-func (h *handshake) consumeInitiation(msg *message.HandshakeInitiation, sPriv, sPub noise.Key) (noise.Key, error) {
+func (h *handshake) consumeInitiation(msg *message.HandshakeInitiation, static StaticKey, sPub noise.Key) (noise.Key, error) {
 	var (
 		chainingKey noise.HashSum
 		hash        noise.HashSum
 		key         noise.Key
+		err         error
 	)
 
 	chainingKey = initChainingKey
@@ -104,7 +118,9 @@ func (h *handshake) consumeInitiation(msg *message.HandshakeInitiation, sPriv, s
 	chainingKey.MixKDF1(e[:])
 
 	/* es */
-	key = chainingKey.MixDH(sPriv, e)
+	if key, err = mixStaticDH(&chainingKey, static, e); err != nil {
+		return noise.Key{}, err
+	}
 
 	/* version */
 	v := hash.MixOpenVersion(key, msg.EncryptedVersion)
@@ -114,11 +130,15 @@ func (h *handshake) consumeInitiation(msg *message.HandshakeInitiation, sPriv, s
 	s := hash.MixOpenKey(key, msg.EncryptedStatic)
 
 	/* ss */
-	ss := sPriv.SharedSecret(s)
+	ss, err := h.computeStaticStatic(static, sPub, s)
+	if err != nil {
+		return noise.Key{}, err
+	}
 	key = chainingKey.MixKey(ss)
 
 	/* Success! Copy everything to handshake */
 	h.remoteEphemeral = e
+	h.sessionEphemeral = e
 	h.staticStatic = ss
 	h.version = v
 	h.hash = hash
@@ -128,7 +148,7 @@ func (h *handshake) consumeInitiation(msg *message.HandshakeInitiation, sPriv, s
 	return s, nil
 }
 
-func (h *handshake) createResponse(sPriv, sPub, rs, psk noise.Key) (*message.HandshakeResponse, error) {
+func (h *handshake) createResponse(rs, psk noise.Key) (*message.HandshakeResponse, error) {
 	var (
 		msg message.HandshakeResponse
 
@@ -141,16 +161,22 @@ func (h *handshake) createResponse(sPriv, sPub, rs, psk noise.Key) (*message.Han
 	if err != nil {
 		return nil, err
 	}
+	defer func() { ePriv = noise.Key{} }()
+
 	msg.UnencryptedEphemeral = ePub
 	h.hash.Mix(ePub[:])
 	h.chainingKey.MixKDF1(ePub[:])
 
 	/* ee */
 
-	h.chainingKey.MixDH(ePriv, h.remoteEphemeral)
+	if _, err := h.chainingKey.MixDH(ePriv, h.remoteEphemeral); err != nil {
+		return nil, err
+	}
 
 	/* se */
-	h.chainingKey.MixDH(ePriv, rs)
+	if _, err := h.chainingKey.MixDH(ePriv, rs); err != nil {
+		return nil, err
+	}
 
 	/* psk */
 	tmpHash, key = h.chainingKey.MixPSK(psk)
@@ -166,7 +192,7 @@ func (h *handshake) createResponse(sPriv, sPub, rs, psk noise.Key) (*message.Han
 	return &msg, nil
 }
 
-func (h *handshake) consumeResponse(msg *message.HandshakeResponse, sPriv, psk noise.Key) error {
+func (h *handshake) consumeResponse(msg *message.HandshakeResponse, static StaticKey, psk noise.Key) error {
 	var (
 		hash noise.HashSum
 		key  noise.Key
@@ -178,10 +204,14 @@ func (h *handshake) consumeResponse(msg *message.HandshakeResponse, sPriv, psk n
 	h.chainingKey.MixKDF1(e[:])
 
 	/* ee */
-	h.chainingKey.MixDH(h.ephemeralPrivate, e)
+	if _, err := h.chainingKey.MixDH(h.ephemeralPrivate, e); err != nil {
+		return err
+	}
 
 	/* se */
-	h.chainingKey.MixDH(sPriv, e)
+	if _, err := mixStaticDH(&h.chainingKey, static, e); err != nil {
+		return err
+	}
 
 	/* psk */
 	hash, key = h.chainingKey.MixPSK(psk)
@@ -214,12 +244,16 @@ func (h *handshake) createRekey(rs noise.Key) (*message.HandshakeRekey, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer func() { ePriv = noise.Key{} }()
+
 	msg.UnencryptedEphemeral = ePub
 	hash.Mix(ePub[:])
 	chainingKey.MixKDF1(ePub[:])
 
 	/* es */
-	chainingKey.MixDH(ePriv, rs)
+	if _, err := chainingKey.MixDH(ePriv, rs); err != nil {
+		return nil, err
+	}
 
 	/* ss */
 	key = chainingKey.MixKey(h.staticStatic)
@@ -229,12 +263,14 @@ func (h *handshake) createRekey(rs noise.Key) (*message.HandshakeRekey, error) {
 	msg.EncryptedTimestamp = hash.MixSealTimetstamp(key, ts)
 
 	/* Success! */
+	h.hash = hash
+	h.sessionEphemeral = ePub
 	h.chainingKey = chainingKey
 	h.sendRekey = chainingKey
 	return &msg, nil
 }
 
-func (h *handshake) consumeRekey(msg *message.HandshakeRekey, sPriv, sPub noise.Key) error {
+func (h *handshake) consumeRekey(msg *message.HandshakeRekey, static StaticKey, sPub noise.Key) error {
 	var (
 		chainingKey noise.HashSum
 		hash        noise.HashSum
@@ -250,7 +286,9 @@ func (h *handshake) consumeRekey(msg *message.HandshakeRekey, sPriv, sPub noise.
 	chainingKey.MixKDF1(e[:])
 
 	/* es */
-	chainingKey.MixDH(sPriv, e)
+	if _, err := mixStaticDH(&chainingKey, static, e); err != nil {
+		return err
+	}
 
 	/* ss */
 	key = chainingKey.MixKey(h.staticStatic)
@@ -264,6 +302,7 @@ func (h *handshake) consumeRekey(msg *message.HandshakeRekey, sPriv, sPub noise.
 	/* Success! */
 	h.remoteTimestamp = ts
 	h.hash = hash
+	h.sessionEphemeral = e
 	h.chainingKey = chainingKey
 	h.recvRekey = chainingKey
 
@@ -272,5 +311,43 @@ func (h *handshake) consumeRekey(msg *message.HandshakeRekey, sPriv, sPub noise.
 
 func (h *handshake) beginSession() (noise.Key, noise.Key) {
 	sum1, sum2 := noise.KDF2(h.chainingKey, nil)
+
+	h.ephemeralPrivate = noise.Key{}
+	h.remoteEphemeral = noise.Key{}
+	h.chainingKey = noise.HashSum{}
+
 	return noise.Key(sum1), noise.Key(sum2)
 }
+
+// computeStaticStatic returns the static-static DH result, which is
+// precomputed per peer when rs is in the registry, or per Config when a
+// client dials its PeerPublic.
+func (h *handshake) computeStaticStatic(static StaticKey, sPub, rs noise.Key) (noise.Key, error) {
+	if h.peers != nil {
+		if peer, ok := h.peers.Lookup(rs); ok {
+			return peer.staticStatic(static, sPub)
+		}
+	}
+	if h.precomputed != nil {
+		return precomputeStaticStatic(h.precomputed, static, sPub, rs)
+	}
+	return static.DH(rs)
+}
+
+func mixStaticDH(chainingKey *noise.HashSum, static StaticKey, pub noise.Key) (noise.Key, error) {
+	ss, err := static.DH(pub)
+	if err != nil {
+		return ss, err
+	}
+	defer func() { ss = noise.Key{} }()
+
+	return chainingKey.MixKey(ss), nil
+}
+
+func (h *handshake) zero() {
+	*h = handshake{
+		rand:  h.rand,
+		peers: h.peers,
+		state: h.state,
+	}
+}
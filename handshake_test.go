@@ -0,0 +1,120 @@
+package socketguard
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benburkert/socketguard-go/internal/must"
+	"github.com/benburkert/socketguard-go/message"
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+func TestHandshakeLowOrderPoints(t *testing.T) {
+	for _, low := range must.LowOrderPoints {
+		low := low
+		t.Run(fmt.Sprintf("%x", low[:4]), func(t *testing.T) {
+			cli, srv := mustHandshakePair(t)
+
+			if _, err := new(handshake).withRand().createInitiation(noise.PrivateKey(cliPriv), cliPub, low, DefaultVersion); err != noise.ErrLowOrderPoint {
+				t.Errorf("createInitiation: want error %v, got %v", noise.ErrLowOrderPoint, err)
+			}
+
+			hi := &message.HandshakeInitiation{UnencryptedEphemeral: low}
+			if _, err := new(handshake).consumeInitiation(hi, noise.PrivateKey(srvPriv), srvPub); err != noise.ErrLowOrderPoint {
+				t.Errorf("consumeInitiation: want error %v, got %v", noise.ErrLowOrderPoint, err)
+			}
+
+			hr := &message.HandshakeResponse{UnencryptedEphemeral: low}
+			if err := cli.consumeResponse(hr, noise.PrivateKey(cliPriv), noise.Key{}); err != noise.ErrLowOrderPoint {
+				t.Errorf("consumeResponse: want error %v, got %v", noise.ErrLowOrderPoint, err)
+			}
+
+			hk := &message.HandshakeRekey{UnencryptedEphemeral: low}
+			if err := srv.consumeRekey(hk, noise.PrivateKey(srvPriv), srvPub); err != noise.ErrLowOrderPoint {
+				t.Errorf("consumeRekey: want error %v, got %v", noise.ErrLowOrderPoint, err)
+			}
+		})
+	}
+}
+
+func mustHandshakePair(t *testing.T) (cli, srv *handshake) {
+	t.Helper()
+
+	cli, srv = new(handshake).withRand(), new(handshake).withRand()
+
+	hi, err := cli.createInitiation(noise.PrivateKey(cliPriv), cliPub, srvPub, DefaultVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.consumeInitiation(hi, noise.PrivateKey(srvPriv), srvPub); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.createResponse(cliPub, noise.Key{}); err != nil {
+		t.Fatal(err)
+	}
+	return cli, srv
+}
+
+func (h *handshake) withRand() *handshake {
+	h.rand = rand.Reader
+	return h
+}
+
+func BenchmarkHandshake(b *testing.B) {
+	cliPeers, err := NewPeerRegistry(&Peer{Name: "srv", PublicKey: srvPub})
+	if err != nil {
+		b.Fatal(err)
+	}
+	srvPeers, err := NewPeerRegistry(&Peer{Name: "cli", PublicKey: cliPub})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bench := range []struct {
+		name               string
+		cliPeers, srvPeers *PeerRegistry
+		cliPrecomputed     bool
+	}{
+		{"uncached", nil, nil, false},
+		{"precomputed", cliPeers, srvPeers, false},
+		{"peer-public", nil, nil, true},
+	} {
+		bench := bench
+		b.Run(bench.name, func(b *testing.B) {
+			cliKey, srvKey := noise.PrivateKey(cliPriv), noise.PrivateKey(srvPriv)
+
+			var precomputed *atomic.Value
+			if bench.cliPrecomputed {
+				precomputed = new(atomic.Value)
+			}
+
+			b.ReportAllocs()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				cli := &handshake{rand: rand.Reader, peers: bench.cliPeers, precomputed: precomputed}
+				srv := &handshake{rand: rand.Reader, peers: bench.srvPeers}
+
+				hi, err := cli.createInitiation(cliKey, cliPub, srvPub, DefaultVersion)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := srv.consumeInitiation(hi, srvKey, srvPub); err != nil {
+					b.Fatal(err)
+				}
+				hr, err := srv.createResponse(cliPub, noise.Key{})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := cli.consumeResponse(hr, cliKey, noise.Key{}); err != nil {
+					b.Fatal(err)
+				}
+				cli.beginSession()
+				srv.beginSession()
+			}
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "handshakes/s")
+		})
+	}
+}
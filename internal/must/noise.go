@@ -2,11 +2,33 @@ package must
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 
 	"github.com/benburkert/socketguard-go/noise"
 	"golang.org/x/crypto/poly1305"
 )
 
+// https://cr.yp.to/ecdh.html#validate
+var LowOrderPoints = []noise.Key{
+	Key("0000000000000000000000000000000000000000000000000000000000000000"),
+	Key("0100000000000000000000000000000000000000000000000000000000000000"),
+	Key("e0eb7a7c3b41b8ae1656e3faf19fc46ada098deb9c32b1fd866205165f49b800"),
+	Key("5f9c95bca3508c24b1d0b1559c83ef5b04445cc4581c8e86d8224eddd09f1157"),
+	Key("ecffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f"),
+	Key("edffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f"),
+	Key("eeffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f"),
+}
+
+func Key(hexKey string) noise.Key {
+	var key noise.Key
+	if n, err := hex.Decode(key[:], []byte(hexKey)); err != nil {
+		panic(err)
+	} else if n != noise.KeySize {
+		panic("short key")
+	}
+	return key
+}
+
 func EncryptKey(src, key noise.Key) noise.EncryptedKey {
 	var dst noise.EncryptedKey
 	xor(dst[:noise.KeySize], src[:], key[:])
@@ -14,6 +36,17 @@ func EncryptKey(src, key noise.Key) noise.EncryptedKey {
 	return dst
 }
 
+func EncryptAlert(code uint32, key noise.Key) noise.EncryptedAlert {
+	var (
+		dst noise.EncryptedAlert
+		src [noise.AlertSize]byte
+	)
+	le.PutUint32(src[:], code)
+	xor(dst[:noise.AlertSize], src[:], key[:noise.AlertSize])
+	mac(dst[noise.AlertSize:], dst[:noise.AlertSize], key)
+	return dst
+}
+
 func EncryptTimestamp(t noise.Timestamp, key noise.Key) noise.EncryptedTimestamp {
 	var dst noise.EncryptedTimestamp
 	xor(dst[:noise.TimestampSize], t[:], append(append([]byte{}, key[:]...), key[:]...)[:noise.TimestampSize])
@@ -0,0 +1,35 @@
+package socketguard
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+const (
+	keyLogLabelInitiator = "SOCKETGUARD_INITIATOR_KEY"
+	keyLogLabelResponder = "SOCKETGUARD_RESPONDER_KEY"
+)
+
+var keyLogMu sync.Mutex
+
+func (c *Conn) writeKeyLog(sending bool, key noise.Key) error {
+	if c.keyLog == nil {
+		return nil
+	}
+
+	label := keyLogLabelResponder
+	if sending == c.initiator {
+		label = keyLogLabelInitiator
+	}
+
+	line := fmt.Sprintf("%s %x %x %x\n", label, c.hs.hash[:],
+		c.hs.sessionEphemeral[:], key[:])
+
+	keyLogMu.Lock()
+	defer keyLogMu.Unlock()
+
+	_, err := c.keyLog.Write([]byte(line))
+	return err
+}
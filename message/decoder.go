@@ -1,24 +1,51 @@
 package message
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 )
 
 type Decoder struct {
-	r io.Reader
+	r  io.Reader
+	br *bufio.Reader
+
+	buf  []byte
+	data Data
 }
 
 func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{r}
+	return &Decoder{r: r}
+}
+
+// NewDecoderSize returns a Decoder that reads ahead from r into a buffer of
+// size bytes, so several small messages can be decoded from one read. Bytes
+// read ahead stay in the Decoder for later messages; see Buffered. A size of
+// zero or less returns an unbuffered Decoder.
+func NewDecoderSize(r io.Reader, size int) *Decoder {
+	if size <= 0 {
+		return NewDecoder(r)
+	}
+
+	br := bufio.NewReaderSize(r, size)
+	return &Decoder{r: br, br: br}
 }
 
+// Buffered returns the number of bytes read ahead but not yet decoded.
+func (d *Decoder) Buffered() int {
+	if d.br == nil {
+		return 0
+	}
+	return d.br.Buffered()
+}
+
+// Decode reads the next message. A returned *Data and its EncryptedData are
+// owned by the Decoder and are only valid until the next call to Decode.
 func (d *Decoder) Decode() (Message, error) {
 	hdr, err := d.decodeHeader()
 	if err != nil {
 		return nil, err
 	}
-
 	var msg Message
 	switch hdr.Type {
 	case handshakeInitiation:
@@ -28,35 +55,130 @@ func (d *Decoder) Decode() (Message, error) {
 	case handshakeRekey:
 		msg = new(HandshakeRekey)
 	case data:
-		msg = new(Data)
+		d.data = Data{}
+		msg = &d.data
+	case alert:
+		msg = new(Alert)
 	default:
 		return nil, UnknownTypeError(hdr.Type)
 	}
 
-	buf := make([]byte, hdr.Len)
-	if _, err := io.ReadFull(d.r, buf); err != nil {
+	size := hdr.Len
+	if msg.Len() > size {
+		size = msg.Len()
+	}
+
+	if d.br != nil && size == hdr.Len && int(size) <= d.br.Size() {
+		// decode directly from the read ahead buffer
+		buf, err := d.br.Peek(int(size))
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		d.br.Discard(len(buf))
+
+		msg.unpack(buf)
+		return msg, nil
+	}
+
+	if size > recordSize-HeaderSize {
+		// Writers seal at most MaxPlaintextSize bytes per record, but older
+		// peers sealed each Write whole, so larger records are still read.
+		buf, err := readLarge(d.r, int(size))
+		if err != nil {
+			return nil, err
+		}
+
+		msg.unpack(buf)
+		return msg, nil
+	}
+
+	if cap(d.buf) < int(size) {
+		d.buf = make([]byte, size)
+	}
+
+	buf := d.buf[:size]
+	if _, err := io.ReadFull(d.r, buf[:hdr.Len]); err != nil {
 		return nil, err
 	}
-	if msg.Len() > 0 && msg.Len() > hdr.Len {
-		buf = buf[:msg.Len()]
+	for i := range buf[hdr.Len:] {
+		buf[int(hdr.Len)+i] = 0
 	}
 
 	msg.unpack(buf)
 	return msg, nil
 }
 
-func (d *Decoder) decodeHeader() (*header, error) {
-	var buf [8]byte
-	if _, err := io.ReadFull(d.r, buf[:]); err != nil {
-		return nil, err
+func (d *Decoder) decodeHeader() (header, error) {
+	var hdr header
+
+	if d.br != nil {
+		buf, err := d.br.Peek(HeaderSize)
+		if err != nil {
+			if len(buf) == 0 {
+				return hdr, err
+			}
+			return hdr, unexpectedEOF(err)
+		}
+		d.br.Discard(HeaderSize)
+
+		hdr.unpack(buf)
+		return hdr, nil
 	}
 
-	hdr := new(header)
-	hdr.unpack(buf[:])
+	if cap(d.buf) < HeaderSize {
+		d.buf = make([]byte, recordSize)
+	}
+
+	buf := d.buf[:HeaderSize]
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return hdr, err
+	}
 
+	hdr.unpack(buf)
 	return hdr, nil
 }
 
+// readLarge reads a message body of size bytes into a new buffer. The buffer
+// grows at most a record at a time as bytes arrive, so a header claiming a
+// huge body cannot allocate more than the peer actually sends. The buffer is
+// not kept by the Decoder once the next message is decoded.
+func readLarge(r io.Reader, size int) ([]byte, error) {
+	buf := make([]byte, 0, recordSize)
+	for len(buf) < size {
+		n := size - len(buf)
+		if n > recordSize {
+			n = recordSize
+		}
+
+		if avail := cap(buf) - len(buf); avail < n {
+			c := 2 * cap(buf)
+			if c > size {
+				c = size
+			}
+			buf = append(make([]byte, 0, c), buf...)
+		}
+
+		m, err := io.ReadFull(r, buf[len(buf):len(buf)+n])
+		buf = buf[:len(buf)+m]
+		if err != nil {
+			if len(buf) > 0 {
+				return nil, unexpectedEOF(err)
+			}
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// unexpectedEOF matches io.ReadFull, which reports a message cut short by
+// EOF as io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
 type UnknownTypeError Type
 
 func (e UnknownTypeError) Error() string {
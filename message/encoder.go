@@ -1,25 +1,122 @@
 package message
 
-import "io"
+import (
+	"io"
+	"net"
+	"sync"
+
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+// MaxPlaintextSize is the largest plaintext a writer seals into a single Data
+// message. Record buffers are pooled at the matching size. Decoders still
+// accept larger records from peers that seal each write whole.
+const MaxPlaintextSize = 1 << 14
+
+const recordSize = HeaderSize + MaxPlaintextSize + noise.AuthTagSize
+
+var recordPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, recordSize)
+		return &buf
+	},
+}
+
+// GetBuffer returns a pooled buffer with room for a record of
+// MaxPlaintextSize bytes. Buffers are returned to the pool with PutBuffer.
+func GetBuffer() *[]byte {
+	return recordPool.Get().(*[]byte)
+}
+
+func PutBuffer(buf *[]byte) {
+	if cap(*buf) != recordSize {
+		return
+	}
+	*buf = (*buf)[:recordSize]
+	recordPool.Put(buf)
+}
 
 type Encoder struct {
 	w io.Writer
+
+	hdrs  []byte
+	bufs  net.Buffers
+	wbufs net.Buffers
 }
 
 func NewEncoder(w io.Writer) *Encoder {
-	return &Encoder{w}
+	return &Encoder{w: w}
 }
 
 func (e *Encoder) Encode(msg Message) error {
-	hdr := &header{
+	if len(e.bufs) > 0 {
+		e.Queue(msg)
+		return e.Flush()
+	}
+
+	size := HeaderSize + int(msg.Len())
+
+	var (
+		pbuf *[]byte
+		buf  []byte
+	)
+	if size <= recordSize {
+		pbuf = GetBuffer()
+		defer PutBuffer(pbuf)
+
+		buf = (*pbuf)[:0]
+	} else {
+		buf = make([]byte, 0, size)
+	}
+
+	hdr := header{
 		Type: msg.Type(),
 		Len:  msg.Len(),
 	}
 
-	buf := make([]byte, 0, 8+msg.Len())
 	buf = hdr.pack(buf)
 	buf = msg.pack(buf)
 
 	_, err := e.w.Write(buf)
 	return err
 }
+
+// Queue adds msg to the batch written by the next Flush. The encrypted data
+// of a Data message is queued by reference and must not be modified until
+// then; other messages are copied.
+func (e *Encoder) Queue(msg Message) {
+	hdr := header{
+		Type: msg.Type(),
+		Len:  msg.Len(),
+	}
+
+	// earlier queued slices keep pointing at the old array if hdrs grows
+	off := len(e.hdrs)
+	e.hdrs = hdr.pack(e.hdrs)
+
+	if data, ok := msg.(*Data); ok {
+		e.bufs = append(e.bufs, e.hdrs[off:], data.EncryptedData)
+		return
+	}
+
+	e.hdrs = msg.pack(e.hdrs)
+	e.bufs = append(e.bufs, e.hdrs[off:])
+}
+
+// Flush writes the queued messages. When the writer supports it, such as a
+// *net.TCPConn, the batch is sent with a single writev.
+func (e *Encoder) Flush() error {
+	if len(e.bufs) == 0 {
+		return nil
+	}
+
+	// WriteTo consumes the slice it is called on
+	e.wbufs = e.bufs
+	_, err := e.wbufs.WriteTo(e.w)
+
+	for i := range e.bufs {
+		e.bufs[i] = nil
+	}
+	e.bufs, e.wbufs, e.hdrs = e.bufs[:0], nil, e.hdrs[:0]
+	return err
+}
@@ -2,29 +2,50 @@ package message
 
 import (
 	"encoding/binary"
+	"fmt"
 
 	"github.com/benburkert/socketguard-go/noise"
 )
 
 type Type uint32
 
+const HeaderSize = 8
+
 const (
 	invalid             Type = 0
 	handshakeInitiation Type = 1
 	handshakeResponse   Type = 2
 	handshakeRekey      Type = 3
 	data                Type = 4
+	alert               Type = 5
 )
 
 var le = binary.LittleEndian
 
+func (t Type) String() string {
+	switch t {
+	case handshakeInitiation:
+		return "HandshakeInitiation"
+	case handshakeResponse:
+		return "HandshakeResponse"
+	case handshakeRekey:
+		return "HandshakeRekey"
+	case data:
+		return "Data"
+	case alert:
+		return "Alert"
+	default:
+		return fmt.Sprintf("Type(%d)", uint32(t))
+	}
+}
+
 type header struct {
 	Type
 	Len uint32
 }
 
 func (h *header) pack(b []byte) []byte {
-	var buf [8]byte
+	var buf [HeaderSize]byte
 	le.PutUint32(buf[:], uint32(h.Type))
 	le.PutUint32(buf[4:], uint32(h.Len))
 	return append(b, buf[:]...)
@@ -137,6 +158,23 @@ func (d *Data) pack(b []byte) []byte {
 }
 
 func (d *Data) unpack(b []byte) {
-	d.EncryptedData = make([]byte, len(b))
-	copy(d.EncryptedData, b)
+	d.EncryptedData = b
+}
+
+type Alert struct {
+	EncryptedAlert noise.EncryptedAlert
+}
+
+func (a *Alert) Type() Type { return alert }
+
+func (a *Alert) Len() uint32 {
+	return noise.EncryptedAlertSize
+}
+
+func (a *Alert) pack(b []byte) []byte {
+	return append(b, a.EncryptedAlert[:]...)
+}
+
+func (a *Alert) unpack(b []byte) {
+	copy(a.EncryptedAlert[:], b)
 }
@@ -2,8 +2,10 @@ package message
 
 import (
 	"bytes"
+	"io"
 	"reflect"
 	"testing"
+	"testing/iotest"
 
 	"github.com/benburkert/socketguard-go/internal/must"
 	"github.com/benburkert/socketguard-go/noise"
@@ -27,6 +29,8 @@ var (
 	tEnc = must.EncryptTimestamp(t, kEnc)
 
 	dEnc = must.RandBytes(1024 + noise.AuthTagSize)
+
+	aEnc = must.EncryptAlert(1, kEnc)
 )
 
 func TestHandshakeInitiation(t *testing.T) {
@@ -153,6 +157,37 @@ func TestData(t *testing.T) {
 	}.test(t)
 }
 
+func TestAlert(t *testing.T) {
+	testCases{
+		{
+			name: "zero-value",
+
+			buf: must.Bytes(
+				uint32(alert),
+				must.Bytes(must.LenU32,
+					make([]byte, noise.EncryptedAlertSize),
+				),
+			),
+
+			msg: &Alert{},
+		},
+		{
+			name: "happy-path",
+
+			buf: must.Bytes(
+				uint32(alert),
+				must.Bytes(must.LenU32,
+					aEnc[:],
+				),
+			),
+
+			msg: &Alert{
+				EncryptedAlert: aEnc,
+			},
+		},
+	}.test(t)
+}
+
 type testCase struct {
 	name string
 
@@ -196,3 +231,167 @@ func (tests testCases) test(t *testing.T) {
 		test.test(t)
 	}
 }
+
+func TestDecoderReuse(t *testing.T) {
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf)
+	for _, msg := range []Message{
+		&Data{EncryptedData: []byte("longer record")},
+		&Data{EncryptedData: []byte("short")},
+		&Data{},
+	} {
+		if err := enc.Encode(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf.Write([]byte{5, 0, 0, 0, 1, 0, 0, 0, 0xff}) // truncated Alert body
+
+	dec := NewDecoder(&buf)
+	for _, want := range []string{"longer record", "short", ""} {
+		msg, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(msg.(*Data).EncryptedData); want != got {
+			t.Errorf("want data %q, got %q", want, got)
+		}
+	}
+
+	msg, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := (noise.EncryptedAlert{0xff}), msg.(*Alert).EncryptedAlert; want != got {
+		t.Errorf("want zero padded alert %x, got %x", want, got)
+	}
+}
+
+func TestDecoderSize(t *testing.T) {
+	msgs := []Message{
+		&HandshakeRekey{UnencryptedEphemeral: ePub},
+		&Data{EncryptedData: []byte("small")},
+		&Data{EncryptedData: bytes.Repeat([]byte("large"), 100)},
+		&Data{},
+		&Alert{EncryptedAlert: noise.EncryptedAlert{1, 2, 3}},
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, msg := range msgs {
+		if err := enc.Encode(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, size := range []int{16, 64, 4096} {
+		for _, oneByte := range []bool{false, true} {
+			var r io.Reader = bytes.NewReader(buf.Bytes())
+			if oneByte {
+				r = iotest.OneByteReader(r)
+			}
+
+			dec := NewDecoderSize(r, size)
+			for i, want := range msgs {
+				got, err := dec.Decode()
+				if err != nil {
+					t.Fatalf("size %d: message %d: %v", size, i, err)
+				}
+				if d, ok := want.(*Data); ok && len(d.EncryptedData) == 0 {
+					want = &Data{EncryptedData: []byte{}}
+				}
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("size %d: want message %d %+v, got %+v", size, i, want, got)
+				}
+			}
+			if _, err := dec.Decode(); err != io.EOF {
+				t.Errorf("size %d: want EOF, got %v", size, err)
+			}
+		}
+	}
+
+	dec := NewDecoderSize(bytes.NewReader(buf.Bytes()[:HeaderSize+3]), 64)
+	if _, err := dec.Decode(); err != io.ErrUnexpectedEOF {
+		t.Errorf("want error %v for truncated message, got %v", io.ErrUnexpectedEOF, err)
+	}
+
+	dec = NewDecoderSize(bytes.NewReader(buf.Bytes()), 4096)
+	if _, err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := buf.Len()-HeaderSize-int(msgs[0].Len()), dec.Buffered(); want != got {
+		t.Errorf("want %d bytes read ahead, got %d", want, got)
+	}
+}
+
+func TestEncoderQueue(t *testing.T) {
+	msgs := []Message{
+		&HandshakeRekey{UnencryptedEphemeral: ePub},
+		&Data{EncryptedData: []byte("first")},
+		&Data{EncryptedData: []byte("second")},
+		&Alert{EncryptedAlert: noise.EncryptedAlert{1, 2, 3}},
+	}
+
+	var want bytes.Buffer
+	enc := NewEncoder(&want)
+	for _, msg := range msgs {
+		if err := enc.Encode(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got bytes.Buffer
+	enc = NewEncoder(&got)
+	for _, msg := range msgs {
+		enc.Queue(msg)
+	}
+	if got.Len() != 0 {
+		t.Fatalf("want nothing written before Flush, got %d bytes", got.Len())
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want.Bytes(), got.Bytes()) {
+		t.Errorf("want queued messages %x, got %x", want.Bytes(), got.Bytes())
+	}
+
+	// a queued batch is written ahead of an encoded message
+	got.Reset()
+	enc.Queue(msgs[0])
+	if err := enc.Encode(msgs[1]); err != nil {
+		t.Fatal(err)
+	}
+	if n := HeaderSize + int(msgs[0].Len()+msgs[1].Len()) + HeaderSize; n != got.Len() {
+		t.Errorf("want %d bytes written, got %d", n, got.Len())
+	}
+}
+
+func TestDecoderLarge(t *testing.T) {
+	for _, size := range []int{0, 4096} {
+		// a header claiming a 4 GiB Data body, followed by one record
+		buf := append([]byte{4, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}, make([]byte, recordSize)...)
+
+		if _, err := NewDecoderSize(bytes.NewReader(buf), size).Decode(); err != io.ErrUnexpectedEOF {
+			t.Errorf("size %d: want error %v, got %v", size, io.ErrUnexpectedEOF, err)
+		}
+	}
+
+	for _, n := range []int{MaxPlaintextSize, 4*MaxPlaintextSize + 1} {
+		want := &Data{EncryptedData: must.RandBytes(n + noise.AuthTagSize)}
+
+		for _, size := range []int{0, 4096} {
+			var buf bytes.Buffer
+			if err := NewEncoder(&buf).Encode(want); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := NewDecoderSize(&buf, size).Decode()
+			if err != nil {
+				t.Fatalf("%d bytes, size %d: %v", n, size, err)
+			}
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("%d bytes, size %d: decoded record does not match", n, size)
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package noise
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const keyFileMode os.FileMode = 0600
+
+var ErrInvalidKey = errors.New("socketguard: invalid key encoding")
+
+type PrivateKey Key
+
+func ParseKey(s string) (Key, error) {
+	var (
+		key Key
+		buf []byte
+		err error
+	)
+
+	s = strings.TrimSpace(s)
+	switch len(s) {
+	case base64.StdEncoding.EncodedLen(KeySize):
+		buf, err = base64.StdEncoding.DecodeString(s)
+	case hex.EncodedLen(KeySize):
+		buf, err = hex.DecodeString(s)
+	default:
+		return key, ErrInvalidKey
+	}
+	if err != nil || len(buf) != KeySize {
+		return key, ErrInvalidKey
+	}
+
+	copy(key[:], buf)
+	return key, nil
+}
+
+func (k Key) String() string {
+	return base64.StdEncoding.EncodeToString(k[:])
+}
+
+func (k Key) MarshalText() ([]byte, error) {
+	buf := make([]byte, base64.StdEncoding.EncodedLen(KeySize), base64.StdEncoding.EncodedLen(KeySize)+1)
+	base64.StdEncoding.Encode(buf, k[:])
+	return buf, nil
+}
+
+func (k *Key) UnmarshalText(text []byte) error {
+	key, err := ParseKey(string(text))
+	if err != nil {
+		return err
+	}
+	*k = key
+	return nil
+}
+
+func (k PrivateKey) String() string {
+	return "(redacted)"
+}
+
+func (k PrivateKey) MarshalText() ([]byte, error) {
+	return Key(k).MarshalText()
+}
+
+func (k *PrivateKey) UnmarshalText(text []byte) error {
+	return (*Key)(k).UnmarshalText(text)
+}
+
+func LoadKeyFile(name string) (Key, error) {
+	var key Key
+
+	buf, err := readKeyFile(name)
+	if err != nil {
+		return key, err
+	}
+	defer zero(buf)
+
+	if err := key.UnmarshalText(buf); err != nil {
+		return key, fmt.Errorf("%w: %s", err, name)
+	}
+	return key, nil
+}
+
+func WriteKeyFile(name string, key Key) error {
+	buf, _ := key.MarshalText()
+	buf = append(buf, '\n')
+	defer zero(buf)
+
+	return writeKeyFile(name, buf)
+}
+
+func readKeyFile(name string) ([]byte, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if perm := fi.Mode().Perm(); perm&^keyFileMode != 0 {
+		return nil, fmt.Errorf("socketguard: key file %s has permissions %#o, want %#o", name, perm, keyFileMode)
+	}
+	return ioutil.ReadFile(name)
+}
+
+func writeKeyFile(name string, buf []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, keyFileMode)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(keyFileMode); err != nil {
+		f.Close()
+		return err
+	}
+
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
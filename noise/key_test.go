@@ -0,0 +1,158 @@
+package noise
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testKey = Key{
+	0x60, 0x09, 0xf3, 0xe1, 0xe5, 0x46, 0x90, 0x9b,
+	0x8b, 0xa4, 0x03, 0x2f, 0x28, 0x1a, 0xdf, 0x7a,
+	0xaf, 0xfb, 0x75, 0x29, 0x1c, 0xd2, 0x03, 0x27,
+	0xf9, 0xf2, 0x4c, 0xaf, 0x63, 0xac, 0xcb, 0x53,
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		name string
+
+		text string
+
+		key Key
+		err error
+	}{
+		{
+			name: "base64",
+			text: "YAnz4eVGkJuLpAMvKBrfeq/7dSkc0gMn+fJMr2Osy1M=",
+			key:  testKey,
+		},
+		{
+			name: "base64-newline",
+			text: "YAnz4eVGkJuLpAMvKBrfeq/7dSkc0gMn+fJMr2Osy1M=\n",
+			key:  testKey,
+		},
+		{
+			name: "hex",
+			text: hex.EncodeToString(testKey[:]),
+			key:  testKey,
+		},
+		{
+			name: "short",
+			text: "YAnz4eVGkJuLpAMvKBrfeq/7dSkc0gMn+fJMr2Osy1=",
+			err:  ErrInvalidKey,
+		},
+		{
+			name: "bad-base64",
+			text: "YAnz4eVGkJuLpAMvKBrfeq/7dSkc0gMn+fJMr2Osy1M!",
+			err:  ErrInvalidKey,
+		},
+		{
+			name: "bad-hex",
+			text: "zz" + hex.EncodeToString(testKey[1:]),
+			err:  ErrInvalidKey,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			key, err := ParseKey(test.text)
+			if want, got := test.err, err; want != got {
+				t.Fatalf("want error %v, got %v", want, got)
+			}
+			if want, got := test.key, key; want != got {
+				t.Errorf("want key %x, got %x", want[:], got[:])
+			}
+		})
+	}
+}
+
+func TestKeyText(t *testing.T) {
+	text, err := testKey.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "YAnz4eVGkJuLpAMvKBrfeq/7dSkc0gMn+fJMr2Osy1M=", string(text); want != got {
+		t.Errorf("want text %q, got %q", want, got)
+	}
+
+	var priv PrivateKey
+	if err := priv.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := testKey, Key(priv); want != got {
+		t.Errorf("want key %x, got %x", want[:], got[:])
+	}
+
+	if want, got := "(redacted)", fmt.Sprint(priv); want != got {
+		t.Errorf("want private key string %q, got %q", want, got)
+	}
+	if want, got := string(text), testKey.String(); want != got {
+		t.Errorf("want key string %q, got %q", want, got)
+	}
+}
+
+func TestKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "noise")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "private.key")
+	if err := ioutil.WriteFile(name, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteKeyFile(name, testKey); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := keyFileMode, fi.Mode().Perm(); want != got {
+		t.Errorf("want key file mode %#o, got %#o", want, got)
+	}
+
+	key, err := LoadKeyFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := testKey, key; want != got {
+		t.Errorf("want key %x, got %x", want[:], got[:])
+	}
+
+	if err := os.Chmod(name, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadKeyFile(name); err == nil {
+		t.Error("want error loading world readable key file")
+	}
+}
+
+func TestPrivateKeyPublic(t *testing.T) {
+	priv, pub, err := GenerateKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := pub, PrivateKey(priv).Public(); want != got {
+		t.Errorf("want public key %x, got %x", want[:], got[:])
+	}
+
+	unclamped := priv
+	unclamped[0] |= 7
+	unclamped[31] |= 128
+	if want, got := pub, PrivateKey(unclamped).Public(); want != got {
+		t.Errorf("want unclamped public key %x, got %x", want[:], got[:])
+	}
+}
@@ -0,0 +1,197 @@
+package noise
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// An encrypted key file holds a single base64 line encoding:
+//
+//	[4]byte magic "sgek"
+//	u8      format version (1)
+//	u8      kdf (1: argon2id)
+//	u32     argon2id time
+//	u32     argon2id memory (KiB)
+//	u8      argon2id threads
+//	[16]byte salt
+//	[12]byte nonce
+//	[48]byte ChaCha20-Poly1305 sealed key
+//
+// Multi-byte integers are little-endian. The header, everything before the
+// sealed key, is the additional data of the AEAD.
+const (
+	encryptedKeyVersion1 = 1
+
+	kdfArgon2id = 1
+
+	encryptedKeyHeaderSize = 4 + 1 + 1 + 4 + 4 + 1 + 16 + chacha20poly1305.NonceSize
+	encryptedKeySize       = encryptedKeyHeaderSize + EncryptedKeySize
+
+	maxArgon2Memory = 4 << 20 // KiB
+)
+
+var (
+	ErrEmptyPassphrase   = errors.New("socketguard: empty passphrase")
+	ErrInvalidPassphrase = errors.New("socketguard: incorrect passphrase or corrupt key file")
+	ErrNotEncrypted      = errors.New("socketguard: key file is not encrypted")
+)
+
+var encryptedKeyMagic = [4]byte{'s', 'g', 'e', 'k'}
+
+var argon2Params = struct {
+	time, memory uint32
+	threads      uint8
+}{3, 64 << 10, 4}
+
+// A Passphrase returns the passphrase protecting an encrypted key file. The
+// returned slice is zeroed after use.
+type Passphrase func() ([]byte, error)
+
+func PassphraseEnv(name string) Passphrase {
+	return func() ([]byte, error) {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("socketguard: passphrase variable %s not set", name)
+		}
+		return []byte(v), nil
+	}
+}
+
+func PassphraseFile(name string) Passphrase {
+	return func() ([]byte, error) {
+		buf, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimRight(buf, "\r\n"), nil
+	}
+}
+
+func EncryptKey(key Key, passphrase Passphrase) ([]byte, error) {
+	pass, err := readPassphrase(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(pass)
+
+	buf := make([]byte, encryptedKeyHeaderSize, encryptedKeySize)
+	copy(buf, encryptedKeyMagic[:])
+	buf[4] = encryptedKeyVersion1
+	buf[5] = kdfArgon2id
+	le.PutUint32(buf[6:], argon2Params.time)
+	le.PutUint32(buf[10:], argon2Params.memory)
+	buf[14] = argon2Params.threads
+
+	if _, err := io.ReadFull(rand.Reader, buf[15:encryptedKeyHeaderSize]); err != nil {
+		return nil, err
+	}
+
+	aead, err := keyFileAEAD(buf, pass)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := buf[15+16 : encryptedKeyHeaderSize]
+	return aead.Seal(buf, nonce, key[:], buf), nil
+}
+
+func DecryptKey(data []byte, passphrase Passphrase) (Key, error) {
+	var key Key
+
+	if len(data) < len(encryptedKeyMagic) || !bytes.Equal(data[:4], encryptedKeyMagic[:]) {
+		return key, ErrNotEncrypted
+	}
+	if len(data) < 6 || data[4] != encryptedKeyVersion1 || data[5] != kdfArgon2id {
+		return key, errors.New("socketguard: unsupported encrypted key format")
+	}
+	if len(data) != encryptedKeySize {
+		return key, ErrInvalidKey
+	}
+
+	pass, err := readPassphrase(passphrase)
+	if err != nil {
+		return key, err
+	}
+	defer zero(pass)
+
+	header := data[:encryptedKeyHeaderSize]
+
+	aead, err := keyFileAEAD(header, pass)
+	if err != nil {
+		return key, err
+	}
+
+	nonce := header[15+16:]
+	if _, err := aead.Open(key[:0], nonce, data[encryptedKeyHeaderSize:], header); err != nil {
+		return key, ErrInvalidPassphrase
+	}
+	return key, nil
+}
+
+func EncryptKeyFile(name string, key Key, passphrase Passphrase) error {
+	data, err := EncryptKey(key, passphrase)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, base64.StdEncoding.EncodedLen(len(data)), base64.StdEncoding.EncodedLen(len(data))+1)
+	base64.StdEncoding.Encode(buf, data)
+	return writeKeyFile(name, append(buf, '\n'))
+}
+
+func DecryptKeyFile(name string, passphrase Passphrase) (Key, error) {
+	var key Key
+
+	buf, err := readKeyFile(name)
+	if err != nil {
+		return key, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(buf)))
+	if err != nil {
+		return key, fmt.Errorf("%w: %s", ErrNotEncrypted, name)
+	}
+
+	if key, err = DecryptKey(data, passphrase); err != nil {
+		return key, fmt.Errorf("%w: %s", err, name)
+	}
+	return key, nil
+}
+
+func keyFileAEAD(header, pass []byte) (cipher.AEAD, error) {
+	var (
+		time    = le.Uint32(header[6:])
+		memory  = le.Uint32(header[10:])
+		threads = header[14]
+		salt    = header[15 : 15+16]
+	)
+	if time == 0 || threads == 0 || memory < 8*uint32(threads) || memory > maxArgon2Memory {
+		return nil, errors.New("socketguard: invalid encrypted key parameters")
+	}
+
+	k := argon2.IDKey(pass, salt, time, memory, threads, chacha20poly1305.KeySize)
+	defer zero(k)
+
+	return chacha20poly1305.New(k)
+}
+
+func readPassphrase(passphrase Passphrase) ([]byte, error) {
+	pass, err := passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if len(pass) == 0 {
+		return nil, ErrEmptyPassphrase
+	}
+	return pass, nil
+}
@@ -0,0 +1,90 @@
+package noise
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptedKeyFile(t *testing.T) {
+	params := argon2Params
+	argon2Params.time, argon2Params.memory, argon2Params.threads = 1, 64, 1
+	defer func() { argon2Params = params }()
+
+	dir, err := ioutil.TempDir("", "noise")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("NOISE_TEST_PASSPHRASE", "correct horse")
+	defer os.Unsetenv("NOISE_TEST_PASSPHRASE")
+
+	passFile := filepath.Join(dir, "passphrase")
+	if err := ioutil.WriteFile(passFile, []byte("correct horse\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(dir, "private.key")
+	if err := EncryptKeyFile(name, testKey, PassphraseEnv("NOISE_TEST_PASSPHRASE")); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := keyFileMode, fi.Mode().Perm(); want != got {
+		t.Errorf("want key file mode %#o, got %#o", want, got)
+	}
+
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf, []byte(testKey.String())) {
+		t.Error("encrypted key file contains plaintext key")
+	}
+	if _, err := LoadKeyFile(name); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("want error %v loading encrypted key file, got %v", ErrInvalidKey, err)
+	}
+
+	key, err := DecryptKeyFile(name, PassphraseFile(passFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := testKey, key; want != got {
+		t.Errorf("want key %x, got %x", want[:], got[:])
+	}
+
+	wrong := func() ([]byte, error) { return []byte("battery staple"), nil }
+	if _, err := DecryptKeyFile(name, wrong); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("want error %v, got %v", ErrInvalidPassphrase, err)
+	}
+
+	empty := func() ([]byte, error) { return nil, nil }
+	if err := EncryptKeyFile(name, testKey, empty); err != ErrEmptyPassphrase {
+		t.Errorf("want error %v, got %v", ErrEmptyPassphrase, err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[10]++ // argon2id memory is authenticated
+	if _, err := DecryptKey(data, PassphraseEnv("NOISE_TEST_PASSPHRASE")); err != ErrInvalidPassphrase {
+		t.Errorf("want error %v for tampered header, got %v", ErrInvalidPassphrase, err)
+	}
+
+	plain := filepath.Join(dir, "plain.key")
+	if err := WriteKeyFile(plain, testKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptKeyFile(plain, wrong); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("want error %v, got %v", ErrNotEncrypted, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/cipher"
 	"crypto/hmac"
 	"encoding/binary"
+	"errors"
 	"hash"
 	"io"
 	"time"
@@ -16,13 +17,17 @@ import (
 
 var le = binary.LittleEndian
 
+var ErrLowOrderPoint = errors.New("socketguard: low order curve25519 point")
+
 const (
+	AlertSize     = 4
 	AuthTagSize   = poly1305.TagSize
 	HashSumSize   = blake2s.Size
 	KeySize       = chacha20poly1305.KeySize
 	TimestampSize = 8
 	VersionSize   = 8
 
+	EncryptedAlertSize     = AlertSize + AuthTagSize
 	EncryptedKeySize       = KeySize + AuthTagSize
 	EncryptedTimestampSize = TimestampSize + AuthTagSize
 	EncryptedVersionSize   = VersionSize + AuthTagSize
@@ -35,6 +40,7 @@ type (
 	HashSum   [HashSumSize]byte
 	Version   [VersionSize]byte
 
+	EncryptedAlert     [EncryptedAlertSize]byte
 	EncryptedKey       [EncryptedKeySize]byte
 	EncryptedTimestamp [EncryptedTimestampSize]byte
 	EncryptedVersion   [EncryptedVersionSize]byte
@@ -56,17 +62,38 @@ func GenerateKeyPair(random io.Reader) (priv, pub Key, err error) {
 		return priv, pub, err
 	}
 
-	// curve25519 clamp
-	priv[0] &= 248
-	priv[31] &= 127
-	priv[31] |= 64
-
-	kp := struct{ priv, pub *Key }{&priv, &pub}
-	curve25519.ScalarBaseMult((*[32]byte)(kp.pub), (*[32]byte)(kp.priv))
+	priv = Key(PrivateKey(priv).clamp())
+	pub = PrivateKey(priv).Public()
 
 	return priv, pub, nil
 }
 
+func (k PrivateKey) Public() Key {
+	var pub Key
+
+	priv := k.clamp()
+	defer priv.zero()
+
+	curve25519.ScalarBaseMult((*[32]byte)(&pub), (*[32]byte)(&priv))
+	return pub
+}
+
+func (k PrivateKey) DH(peer Key) (Key, error) {
+	return Key(k).SharedSecret(peer)
+}
+
+func (k PrivateKey) clamp() PrivateKey {
+	// curve25519 clamp
+	k[0] &= 248
+	k[31] &= 127
+	k[31] |= 64
+	return k
+}
+
+func (k *PrivateKey) zero() {
+	zero(k[:])
+}
+
 func (k Key) AEAD() cipher.AEAD {
 	aead, err := chacha20poly1305.New(k[:])
 	if err != nil {
@@ -75,10 +102,17 @@ func (k Key) AEAD() cipher.AEAD {
 	return aead
 }
 
-func (k Key) SharedSecret(pub Key) Key {
+func (k Key) SharedSecret(pub Key) (Key, error) {
 	var dst Key
-	curve25519.ScalarMult((*[32]byte)(&dst), (*[32]byte)(&k), (*[32]byte)(&pub))
-	return dst
+
+	buf, err := curve25519.X25519(k[:], pub[:])
+	if err != nil {
+		return dst, ErrLowOrderPoint
+	}
+	copy(dst[:], buf)
+	zero(buf)
+
+	return dst, nil
 }
 
 var epoch = time.Now()
@@ -123,8 +157,12 @@ func (h *HashSum) Mix(data []byte) {
 	copy(h[:], sum[:])
 }
 
-func (h *HashSum) MixDH(priv, pub Key) Key {
-	return h.MixKey(priv.SharedSecret(pub))
+func (h *HashSum) MixDH(priv, pub Key) (Key, error) {
+	ss, err := priv.SharedSecret(pub)
+	if err != nil {
+		return ss, err
+	}
+	return h.MixKey(ss), nil
 }
 
 func (h *HashSum) MixKDF1(data []byte) {
@@ -245,6 +283,8 @@ type SymmetricKey struct {
 	Key
 	Counter uint64
 	Timestamp
+
+	nonceBuf [chacha20poly1305.NonceSize]byte
 }
 
 func NewSymmetricKey(key Key) *SymmetricKey {
@@ -254,21 +294,44 @@ func NewSymmetricKey(key Key) *SymmetricKey {
 	}
 }
 
+// Open decrypts ciphertext and appends the result to dst[:0]. The
+// ciphertext may be opened in place with dst set to ciphertext[:0].
 func (s *SymmetricKey) Open(dst, ciphertext []byte) ([]byte, error) {
-	return s.AEAD().Open(dst[:0], s.nonce(), ciphertext, nil)
+	return s.Key.AEAD().Open(dst[:0], s.nonce(), ciphertext, nil)
 }
 
+// Seal encrypts plaintext and appends the result to dst[:0]. The plaintext
+// may be sealed in place with dst set to plaintext[:0].
 func (s *SymmetricKey) Seal(dst, plaintext []byte) []byte {
-	return s.AEAD().Seal(dst[:0], s.nonce(), plaintext, nil)
+	return s.Key.AEAD().Seal(dst[:0], s.nonce(), plaintext, nil)
 }
 
-func (s *SymmetricKey) nonce() []byte {
-	defer func() { s.Counter++ }()
+// Reserve advances Counter past n records and returns the first reserved
+// counter. The reserved records may then be sealed concurrently with SealAt.
+func (s *SymmetricKey) Reserve(n uint64) uint64 {
+	counter := s.Counter
+	s.Counter += n
+	return counter
+}
 
+// SealAt is like Seal but uses the nonce for a counter obtained from Reserve
+// and leaves Counter unchanged.
+func (s *SymmetricKey) SealAt(dst, plaintext []byte, counter uint64) []byte {
 	var nonce [chacha20poly1305.NonceSize]byte
+	le.PutUint64(nonce[len(nonce)-8:], counter)
+	return s.Key.AEAD().Seal(dst[:0], nonce[:], plaintext, nil)
+}
 
-	le.PutUint64(nonce[len(nonce)-8:], s.Counter)
-	return nonce[:]
+// Wipe zeroes the key. Seal and Open build their AEAD from the key on each
+// call instead of caching one, so no other copy of it is left behind.
+func (s *SymmetricKey) Wipe() {
+	*s = SymmetricKey{}
+}
+
+func (s *SymmetricKey) nonce() []byte {
+	le.PutUint64(s.nonceBuf[len(s.nonceBuf)-8:], s.Counter)
+	s.Counter++
+	return s.nonceBuf[:]
 }
 
 func NewVersion(min, max uint16) Version {
@@ -0,0 +1,151 @@
+package noise
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+)
+
+// https://cr.yp.to/ecdh.html#validate
+var lowOrderPoints = []string{
+	"0000000000000000000000000000000000000000000000000000000000000000",
+	"0100000000000000000000000000000000000000000000000000000000000000",
+	"e0eb7a7c3b41b8ae1656e3faf19fc46ada098deb9c32b1fd866205165f49b800",
+	"5f9c95bca3508c24b1d0b1559c83ef5b04445cc4581c8e86d8224eddd09f1157",
+	"ecffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f",
+	"edffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f",
+	"eeffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f",
+}
+
+func TestSharedSecretLowOrder(t *testing.T) {
+	priv, _, err := GenerateKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, point := range lowOrderPoints {
+		var pub Key
+		if _, err := hex.Decode(pub[:], []byte(point)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := priv.SharedSecret(pub); err != ErrLowOrderPoint {
+			t.Errorf("want error %v for point %s, got %v", ErrLowOrderPoint, point, err)
+		}
+
+		var h HashSum
+		if _, err := h.MixDH(priv, pub); err != ErrLowOrderPoint {
+			t.Errorf("want MixDH error %v for point %s, got %v", ErrLowOrderPoint, point, err)
+		}
+		if want, got := (HashSum{}), h; want != got {
+			t.Errorf("want unmixed hash for point %s, got %x", point, got[:])
+		}
+	}
+}
+
+func TestSharedSecret(t *testing.T) {
+	priv1, pub1, err := GenerateKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv2, pub2, err := GenerateKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ss1, err := priv1.SharedSecret(pub2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss2, err := priv2.SharedSecret(pub1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ss1 != ss2 {
+		t.Errorf("want matching shared secrets, got %x and %x", ss1[:], ss2[:])
+	}
+}
+
+func TestSymmetricKeyInPlace(t *testing.T) {
+	key, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	send, recv := NewSymmetricKey(key), NewSymmetricKey(key)
+
+	buf := make([]byte, 64, 64+AuthTagSize)
+	copy(buf, "attack at dawn")
+
+	if allocs := testing.AllocsPerRun(100, func() {
+		sealed := send.Seal(buf[:0], buf)
+		opened, err := recv.Open(sealed[:0], sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf = opened
+	}); allocs != 0 {
+		t.Errorf("want 0 allocations per seal and open, got %v", allocs)
+	}
+
+	if want, got := "attack at dawn", string(buf[:14]); want != got {
+		t.Errorf("want plaintext %q, got %q", want, got)
+	}
+	if want, got := send.Counter, recv.Counter; want != got {
+		t.Errorf("want matching counters, got %d and %d", want, got)
+	}
+}
+
+func TestSymmetricKeySealAt(t *testing.T) {
+	key, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, par := NewSymmetricKey(key), NewSymmetricKey(key)
+
+	plaintexts := [][]byte{[]byte("one"), []byte("two"), []byte("three")}
+
+	counter := par.Reserve(uint64(len(plaintexts)))
+	if want, got := uint64(len(plaintexts)), par.Counter; want != got {
+		t.Errorf("want counter %d after reserve, got %d", want, got)
+	}
+
+	for i, p := range plaintexts {
+		want := seq.Seal(nil, p)
+		if got := par.SealAt(nil, p, counter+uint64(i)); !bytes.Equal(want, got) {
+			t.Errorf("record %d: want %x, got %x", i, want, got)
+		}
+	}
+}
+
+func TestSymmetricKeyWipe(t *testing.T) {
+	key, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSymmetricKey(key)
+	s.Seal(nil, []byte("attack at dawn"))
+
+	s.Wipe()
+	if want, got := (SymmetricKey{}), *s; want != got {
+		t.Errorf("want zeroed key, got %+v", got)
+	}
+}
+
+func BenchmarkSymmetricKeySeal(b *testing.B) {
+	key, err := GenerateKey(rand.Reader)
+	if err != nil {
+		b.Fatal(err)
+	}
+	s := NewSymmetricKey(key)
+
+	plaintext := make([]byte, 1024)
+	dst := make([]byte, 0, len(plaintext)+AuthTagSize)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(plaintext)))
+	for i := 0; i < b.N; i++ {
+		s.Seal(dst, plaintext)
+	}
+}
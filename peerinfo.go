@@ -0,0 +1,90 @@
+package socketguard
+
+import (
+	"syscall"
+
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+// The peer info reported by the kernel module shares the crypto info
+// header, followed by:
+//
+//	u32 handshake state
+//	[8]byte negotiated version
+//	[32]byte peer public
+//	u64 rekeys sent
+//	u64 rekeys received
+const (
+	peerInfoVersion1 = 1
+
+	peerInfoSizeV1 = cryptoInfoHeaderSize + 4 + noise.VersionSize +
+		noise.KeySize + 8 + 8
+)
+
+type HandshakeState uint32
+
+const (
+	HandshakeZeroed HandshakeState = iota
+	HandshakeInitiated
+	HandshakeFinished
+)
+
+func (s HandshakeState) String() string {
+	switch s {
+	case HandshakeZeroed:
+		return "zeroed"
+	case HandshakeInitiated:
+		return "initiated"
+	case HandshakeFinished:
+		return "finished"
+	default:
+		return "unknown"
+	}
+}
+
+type PeerInfo struct {
+	PeerPublic noise.Key
+	Version    noise.Version
+	State      HandshakeState
+
+	RekeysSent     uint64
+	RekeysReceived uint64
+}
+
+func (c *Config) PeerInfo(conn syscall.Conn) (*PeerInfo, error) {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var info *PeerInfo
+	if cerr := rc.Control(func(fd uintptr) {
+		info, err = c.peerInfo(fd)
+	}); cerr != nil {
+		return nil, cerr
+	}
+	return info, err
+}
+
+func (i *PeerInfo) unpack(b []byte) error {
+	if len(b) < cryptoInfoHeaderSize {
+		return ErrUnsupportedInfo
+	}
+	if version, size := le.Uint16(b), le.Uint16(b[2:]); version != peerInfoVersion1 ||
+		int(size) < peerInfoSizeV1 || int(size) > len(b) {
+		return ErrUnsupportedInfo
+	}
+
+	const (
+		versionOffset = cryptoInfoHeaderSize + 4
+		peerOffset    = versionOffset + noise.VersionSize
+		rekeyOffset   = peerOffset + noise.KeySize
+	)
+
+	i.State = HandshakeState(le.Uint32(b[cryptoInfoHeaderSize:]))
+	copy(i.Version[:], b[versionOffset:])
+	copy(i.PeerPublic[:], b[peerOffset:])
+	i.RekeysSent = le.Uint64(b[rekeyOffset:])
+	i.RekeysReceived = le.Uint64(b[rekeyOffset+8:])
+	return nil
+}
@@ -0,0 +1,177 @@
+package socketguard
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+type Peer struct {
+	Name      string
+	PublicKey noise.Key
+	Labels    map[string]string
+
+	PresharedKey noise.Key
+
+	RekeyAfter  time.Duration
+	RejectAfter time.Duration
+
+	precomputed atomic.Value // *precomputed
+}
+
+// precomputed is the static-static DH result of a peer and a local static
+// key. It is recomputed when either public key changes.
+type precomputed struct {
+	static, peer noise.Key
+	ss           noise.Key
+}
+
+func (p *Peer) staticStatic(static StaticKey, sPub noise.Key) (noise.Key, error) {
+	return precomputeStaticStatic(&p.precomputed, static, sPub, p.PublicKey)
+}
+
+// precomputeStaticStatic returns the static-static DH result of static and
+// rs, reusing the one stored in v unless either public key changed.
+func precomputeStaticStatic(v *atomic.Value, static StaticKey, sPub, rs noise.Key) (noise.Key, error) {
+	if pc, ok := v.Load().(*precomputed); ok && pc.static == sPub && pc.peer == rs {
+		return pc.ss, nil
+	}
+
+	ss, err := static.DH(rs)
+	if err != nil {
+		return ss, err
+	}
+
+	v.Store(&precomputed{static: sPub, peer: rs, ss: ss})
+	return ss, nil
+}
+
+type PeerRegistry struct {
+	peers atomic.Value // map[noise.Key]*Peer
+}
+
+func NewPeerRegistry(peers ...*Peer) (*PeerRegistry, error) {
+	r := new(PeerRegistry)
+	if err := r.Replace(peers...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func LoadPeerRegistry(name string) (*PeerRegistry, error) {
+	r := new(PeerRegistry)
+	if err := r.Reload(name); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *PeerRegistry) Lookup(key noise.Key) (*Peer, bool) {
+	peers, _ := r.peers.Load().(map[noise.Key]*Peer)
+	peer, ok := peers[key]
+	return peer, ok
+}
+
+func (r *PeerRegistry) Peers() []*Peer {
+	peers, _ := r.peers.Load().(map[noise.Key]*Peer)
+
+	list := make([]*Peer, 0, len(peers))
+	for _, peer := range peers {
+		list = append(list, peer)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func (r *PeerRegistry) Replace(peers ...*Peer) error {
+	m := make(map[noise.Key]*Peer, len(peers))
+	for _, peer := range peers {
+		if peer.PublicKey == (noise.Key{}) {
+			return fmt.Errorf("socketguard: peer %q: %w", peer.Name, ErrMissingPeerKey)
+		}
+		if _, ok := m[peer.PublicKey]; ok {
+			return fmt.Errorf("socketguard: peer %q: duplicate public key %s", peer.Name, peer.PublicKey)
+		}
+		m[peer.PublicKey] = peer
+	}
+
+	r.peers.Store(m)
+	return nil
+}
+
+// Reload replaces the peers with the contents of a JSON registry file:
+//
+//	{
+//	  "peers": [
+//	    {
+//	      "name": "alice",
+//	      "public_key": "<base64 public key>",
+//	      "labels": {"team": "storage"},
+//	      "preshared_key_file": "alice.psk",
+//	      "rekey_after": "2m",
+//	      "reject_after": "3m"
+//	    }
+//	  ]
+//	}
+//
+// Relative key file paths are resolved against the registry file's directory.
+func (r *PeerRegistry) Reload(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var file struct {
+		Peers []struct {
+			Name             string            `json:"name"`
+			PublicKey        noise.Key         `json:"public_key"`
+			Labels           map[string]string `json:"labels"`
+			PresharedKeyFile string            `json:"preshared_key_file"`
+			RekeyAfter       duration          `json:"rekey_after"`
+			RejectAfter      duration          `json:"reject_after"`
+		} `json:"peers"`
+	}
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return fmt.Errorf("socketguard: %s: %w", name, err)
+	}
+
+	peers := make([]*Peer, 0, len(file.Peers))
+	for _, p := range file.Peers {
+		peer := &Peer{
+			Name:        p.Name,
+			PublicKey:   p.PublicKey,
+			Labels:      p.Labels,
+			RekeyAfter:  time.Duration(p.RekeyAfter),
+			RejectAfter: time.Duration(p.RejectAfter),
+		}
+
+		if pskFile := p.PresharedKeyFile; pskFile != "" {
+			if !filepath.IsAbs(pskFile) {
+				pskFile = filepath.Join(filepath.Dir(name), pskFile)
+			}
+			if peer.PresharedKey, err = noise.LoadKeyFile(pskFile); err != nil {
+				return err
+			}
+		}
+		peers = append(peers, peer)
+	}
+	return r.Replace(peers...)
+}
+
+type duration time.Duration
+
+func (d *duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	*d = duration(v)
+	return err
+}
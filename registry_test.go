@@ -0,0 +1,433 @@
+package socketguard
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benburkert/socketguard-go/internal/must"
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+func TestLoadPeerRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "socketguard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	psk := must.GenerateKey()
+	if err := noise.WriteKeyFile(filepath.Join(dir, "alice.psk"), psk); err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(dir, "peers.json")
+	if err := ioutil.WriteFile(name, []byte(`{
+  "peers": [
+    {
+      "name": "alice",
+      "public_key": "`+cliPub.String()+`",
+      "labels": {"team": "storage"},
+      "preshared_key_file": "alice.psk",
+      "rekey_after": "2m",
+      "reject_after": "3m"
+    },
+    {
+      "name": "bob",
+      "public_key": "`+srvPub.String()+`"
+    }
+  ]
+}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := LoadPeerRegistry(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice, ok := r.Lookup(cliPub)
+	if !ok {
+		t.Fatal("want alice in registry")
+	}
+	if want, got := "alice", alice.Name; want != got {
+		t.Errorf("want name %q, got %q", want, got)
+	}
+	if want, got := "storage", alice.Labels["team"]; want != got {
+		t.Errorf("want team label %q, got %q", want, got)
+	}
+	if want, got := psk, alice.PresharedKey; want != got {
+		t.Errorf("want preshared key %x, got %x", want[:], got[:])
+	}
+	if want, got := 2*time.Minute, alice.RekeyAfter; want != got {
+		t.Errorf("want rekey after %s, got %s", want, got)
+	}
+	if want, got := 3*time.Minute, alice.RejectAfter; want != got {
+		t.Errorf("want reject after %s, got %s", want, got)
+	}
+
+	if want, got := 2, len(r.Peers()); want != got {
+		t.Errorf("want %d peers, got %d", want, got)
+	}
+
+	if err := r.Replace(&Peer{Name: "bob", PublicKey: srvPub}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.Lookup(cliPub); ok {
+		t.Error("want alice removed after replace")
+	}
+
+	if err := r.Replace(&Peer{Name: "a", PublicKey: srvPub}, &Peer{Name: "b", PublicKey: srvPub}); err == nil {
+		t.Error("want duplicate public key error")
+	}
+	if _, ok := r.Lookup(srvPub); !ok {
+		t.Error("want failed replace to keep existing peers")
+	}
+}
+
+func TestConnPeerRegistry(t *testing.T) {
+	cliConf, srvConf := mustConfigPair()
+
+	psk := must.GenerateKey()
+	cliConf.PresharedKey = psk
+
+	var err error
+	if srvConf.Peers, err = NewPeerRegistry(&Peer{
+		Name:         "alice",
+		PublicKey:    cliConf.StaticPublic,
+		PresharedKey: psk,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	cliNet, srvNet := net.Pipe()
+	cli, srv := Client(cliNet, cliConf), Server(srvNet, srvConf)
+	defer cli.Close()
+	defer srv.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := cli.Write([]byte("ping!"))
+		errc <- err
+	}()
+
+	if _, err := io.ReadFull(srv, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "alice", srv.ConnectionState().PeerName; want != got {
+		t.Errorf("want peer name %q, got %q", want, got)
+	}
+
+	cliConf, _ = mustConfigPair()
+	cliConf.PeerPublic = srvConf.StaticPublic
+
+	cliNet, srvNet = net.Pipe()
+	cli, srv = Client(cliNet, cliConf), Server(srvNet, srvConf)
+	defer cli.Close()
+	defer srv.Close()
+
+	go func() {
+		errc <- cli.sendHandshakeInitiation()
+	}()
+
+	if err := srv.Handshake(); err != ErrUnknownPeer {
+		t.Errorf("want error %v, got %v", ErrUnknownPeer, err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if want, got := uint64(1), srv.Stats().HandshakeFailures["unknown_peer"]; want != got {
+		t.Errorf("want %d unknown peer failures, got %d", want, got)
+	}
+}
+
+func TestListenerReload(t *testing.T) {
+	cliConf, srvConf := mustConfigPair()
+	cliConf.PreferGo, srvConf.PreferGo = true, true
+
+	var err error
+	if srvConf.Peers, err = NewPeerRegistry(&Peer{
+		Name:      "alice",
+		PublicKey: cliConf.StaticPublic,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	ln, err := Listen(ctx, "tcp", "127.0.0.1:0", srvConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	srvc := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				if err := conn.(*Conn).Handshake(); err != nil {
+					conn.Close()
+					return
+				}
+				srvc <- conn
+			}()
+		}
+	}()
+
+	cli, err := Dial(ctx, "tcp", ln.Addr().String(), cliConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if _, err := cli.Write([]byte("ping!")); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := <-srvc
+	if _, err := io.ReadFull(srv, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+
+	reload := *srvConf
+	if reload.Peers, err = NewPeerRegistry(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ln.(*Listener).Reload(&reload); err != nil {
+		t.Fatal(err)
+	}
+
+	cli.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := cli.Read(make([]byte, 5)); err != AlertRevoked {
+		t.Errorf("want error %v, got %v", AlertRevoked, err)
+	}
+
+	l := ln.(*Listener)
+	waitUntracked := func() {
+		t.Helper()
+
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			l.mu.Lock()
+			n := len(l.conns)
+			l.mu.Unlock()
+
+			if n == 0 {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("want 0 tracked conns, got %d", n)
+			}
+		}
+	}
+	waitUntracked()
+
+	cli, err = Dial(ctx, "tcp", ln.Addr().String(), cliConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	cli.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := cli.Read(make([]byte, 5)); err == nil {
+		t.Error("want handshake error from revoked peer")
+	}
+
+	// a revoked peer that stops reading is cut off while the server is
+	// blocked writing to it
+	if err := l.Reload(srvConf); err != nil {
+		t.Fatal(err)
+	}
+
+	cli, err = Dial(ctx, "tcp", ln.Addr().String(), cliConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if _, err := cli.Write([]byte("ping!")); err != nil {
+		t.Fatal(err)
+	}
+	srv = <-srvc
+
+	errc := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1<<20)
+		for {
+			if _, err := srv.Write(buf); err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if err := l.Reload(&reload); err != nil {
+		t.Fatal(err)
+	}
+	waitUntracked()
+
+	select {
+	case <-errc:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want blocked server write to fail after revocation")
+	}
+}
+
+func TestListenerReloadHandshaking(t *testing.T) {
+	cliConf, srvConf := mustConfigPair()
+	cliConf.PreferGo, srvConf.PreferGo = true, true
+
+	otherConf := *cliConf
+	otherConf.StaticPrivate, otherConf.StaticPublic = must.GenerateKeyPair()
+
+	var err error
+	if srvConf.Peers, err = NewPeerRegistry(&Peer{
+		Name:      "alice",
+		PublicKey: cliConf.StaticPublic,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	ln, err := Listen(ctx, "tcp", "127.0.0.1:0", srvConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	revoked := *srvConf
+	if revoked.Peers, err = NewPeerRegistry(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name   string
+		config *Config
+		reload *Config
+	}{
+		{"unknown-peer", &otherConf, srvConf},
+		{"revoked-peer", cliConf, &revoked},
+	} {
+		cli, err := Dial(ctx, "tcp", ln.Addr().String(), test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cli.Close()
+
+		srv, err := ln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer srv.Close()
+
+		// the reload must not run the handshake of an accepted conn
+		if err := ln.(*Listener).Reload(test.reload); err != nil {
+			t.Fatal(err)
+		}
+
+		srv.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for i := 0; i < 2; i++ {
+			if _, err := srv.Read(make([]byte, 1)); err != ErrUnknownPeer {
+				t.Errorf("%s: read %d: want error %v, got %v", test.name, i, ErrUnknownPeer, err)
+			}
+		}
+	}
+}
+
+func TestPeerStaticStatic(t *testing.T) {
+	srvKey := &countingKey{PrivateKey: noise.PrivateKey(srvPriv)}
+	peer := &Peer{PublicKey: cliPub}
+
+	for i := 0; i < 2; i++ {
+		ss, err := peer.staticStatic(srvKey, srvPub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := mustDH(t, srvPriv, cliPub), ss; want != got {
+			t.Errorf("want static-static %x, got %x", want[:], got[:])
+		}
+	}
+	if want, got := 1, srvKey.n; want != got {
+		t.Errorf("want %d DH operations, got %d", want, got)
+	}
+
+	newPriv, newPub := must.GenerateKeyPair()
+	newKey := &countingKey{PrivateKey: noise.PrivateKey(newPriv)}
+	if ss, err := peer.staticStatic(newKey, newPub); err != nil {
+		t.Fatal(err)
+	} else if want, got := mustDH(t, newPriv, cliPub), ss; want != got {
+		t.Errorf("want static-static %x after static key rotation, got %x", want[:], got[:])
+	}
+
+	peer.PublicKey = srvPub
+	if ss, err := peer.staticStatic(newKey, newPub); err != nil {
+		t.Fatal(err)
+	} else if want, got := mustDH(t, newPriv, srvPub), ss; want != got {
+		t.Errorf("want static-static %x after peer key rotation, got %x", want[:], got[:])
+	}
+	if want, got := 2, newKey.n; want != got {
+		t.Errorf("want %d DH operations, got %d", want, got)
+	}
+}
+
+func TestConfigStaticStatic(t *testing.T) {
+	cliConf, srvConf := mustConfigPair()
+	cliKey := &countingKey{PrivateKey: noise.PrivateKey(cliConf.StaticPrivate)}
+	cliConf.StaticKey = cliKey
+
+	for i := 0; i < 2; i++ {
+		cli, srv := mustConnPairConfig(t, cliConf, srvConf)
+		cli.Close()
+		srv.Close()
+	}
+
+	// the static-static DH is cached, the static-ephemeral DH of each
+	// response is not
+	if want, got := 3, cliKey.n; want != got {
+		t.Errorf("want %d DH operations, got %d", want, got)
+	}
+
+	newConf := new(Config)
+	newConf.StaticPrivate, newConf.StaticPublic = must.GenerateKeyPair()
+	cliConf.PeerPublic = newConf.StaticPublic
+
+	cli, srv := mustConnPairConfig(t, cliConf, newConf)
+	cli.Close()
+	srv.Close()
+
+	if want, got := 5, cliKey.n; want != got {
+		t.Errorf("want %d DH operations after peer key change, got %d", want, got)
+	}
+}
+
+type countingKey struct {
+	noise.PrivateKey
+	n int
+}
+
+func (k *countingKey) DH(peer noise.Key) (noise.Key, error) {
+	k.n++
+	return k.PrivateKey.DH(peer)
+}
+
+func mustDH(t *testing.T, priv, pub noise.Key) noise.Key {
+	t.Helper()
+
+	ss, err := noise.PrivateKey(priv).DH(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ss
+}
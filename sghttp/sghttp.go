@@ -0,0 +1,100 @@
+package sghttp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/benburkert/socketguard-go"
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+type peerContextKey struct{}
+
+type peerFunc func() (noise.Key, bool)
+
+func NewTransport(config *socketguard.Config, peers map[string]noise.Key) *http.Transport {
+	return &http.Transport{
+		DialContext: DialContext(config, peers),
+	}
+}
+
+func DialContext(config *socketguard.Config, peers map[string]noise.Key) func(context.Context, string, string) (net.Conn, error) {
+	// one config per peer, so each keeps its precomputed handshake state
+	// across dials
+	configs := make(map[noise.Key]*socketguard.Config, len(peers))
+	for _, peer := range peers {
+		if _, ok := configs[peer]; !ok {
+			cfg := *config
+			cfg.PeerPublic = peer
+			configs[peer] = &cfg
+		}
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		peer, ok := peers[addr]
+		if !ok {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			if peer, ok = peers[host]; !ok {
+				return nil, fmt.Errorf("sghttp: no peer key for %s", addr)
+			}
+		}
+
+		return socketguard.Dial(ctx, network, addr, configs[peer])
+	}
+}
+
+func Serve(srv *http.Server, ln net.Listener, config *socketguard.Config) error {
+	sgln, err := config.Listener(ln)
+	if err != nil {
+		return err
+	}
+
+	ConfigureServer(srv, config)
+	return srv.Serve(sgln)
+}
+
+func ConfigureServer(srv *http.Server, config *socketguard.Config) {
+	connContext := srv.ConnContext
+	srv.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if connContext != nil {
+			ctx = connContext(ctx, c)
+		}
+		return context.WithValue(ctx, peerContextKey{}, peerOf(c, config))
+	}
+}
+
+func PeerFromContext(ctx context.Context) (noise.Key, bool) {
+	fn, ok := ctx.Value(peerContextKey{}).(peerFunc)
+	if !ok {
+		return noise.Key{}, false
+	}
+	return fn()
+}
+
+// peerOf returns a lazy lookup of the authenticated peer: ConnContext runs in
+// the server's accept loop, before the handshake has completed.
+func peerOf(c net.Conn, config *socketguard.Config) peerFunc {
+	return func() (noise.Key, bool) {
+		switch c := c.(type) {
+		case *socketguard.Conn:
+			if err := c.Handshake(); err != nil {
+				return noise.Key{}, false
+			}
+			return c.ConnectionState().PeerPublic, true
+		case syscall.Conn:
+			info, err := config.PeerInfo(c)
+			if err != nil || info.State != socketguard.HandshakeFinished {
+				return noise.Key{}, false
+			}
+			return info.PeerPublic, true
+		default:
+			return noise.Key{}, false
+		}
+	}
+}
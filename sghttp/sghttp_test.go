@@ -0,0 +1,73 @@
+package sghttp
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/benburkert/socketguard-go"
+	"github.com/benburkert/socketguard-go/internal/must"
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+func TestPeerIdentity(t *testing.T) {
+	cliPriv, cliPub := must.GenerateKeyPair()
+	srvPriv, srvPub := must.GenerateKeyPair()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, ok := PeerFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthenticated", http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(peer.String()))
+		}),
+	}
+	defer srv.Shutdown(context.Background())
+
+	go Serve(srv, ln, &socketguard.Config{
+		StaticPrivate: srvPriv,
+		PreferGo:      true,
+	})
+
+	client := &http.Client{
+		Transport: NewTransport(&socketguard.Config{
+			StaticPrivate: cliPriv,
+			PreferGo:      true,
+		}, map[string]noise.Key{
+			ln.Addr().String(): srvPub,
+		}),
+	}
+
+	res, err := client.Get("http://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := cliPub.String(), string(body); want != got {
+		t.Errorf("want peer %q, got %q", want, got)
+	}
+
+	_, err = client.Get("http://localhost:1/")
+	if err == nil || !strings.Contains(err.Error(), "no peer key") {
+		t.Errorf("want missing peer key error, got %v", err)
+	}
+
+	if _, ok := PeerFromContext(context.Background()); ok {
+		t.Error("want no peer in background context")
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -26,18 +28,68 @@ type Config struct {
 	StaticPublic  noise.Key
 	StaticPrivate noise.Key
 
+	// StaticKey, if set, performs the static private key operations in
+	// place of StaticPrivate, so the private key can be held elsewhere,
+	// such as by an agent process. It requires PreferGo.
+	StaticKey StaticKey
+
 	PeerPublic noise.Key
 
 	PresharedKey noise.Key
 
+	Peers *PeerRegistry
+
 	RekeyAfter  time.Duration
 	RejectAfter time.Duration
 
 	Rand io.Reader
 
+	// KeyLogWriter, if set, receives every session key negotiated by
+	// PreferGo connections, including keys from rekeys, so packet captures
+	// can be decrypted while debugging. Each key is written as a line:
+	//
+	//	<label> <handshake hash> <ephemeral> <key>
+	//
+	// The hash, ephemeral and key are hex encoded. The ephemeral is the
+	// unencrypted ephemeral of the HandshakeInitiation or HandshakeRekey
+	// message that began the session. The label is the direction of the
+	// traffic the key protects, relative to the roles in the initial
+	// handshake: SOCKETGUARD_INITIATOR_KEY or SOCKETGUARD_RESPONDER_KEY.
+	//
+	// WARNING: anyone with access to the key log can decrypt all traffic
+	// of the logged sessions. Never set KeyLogWriter in production.
+	KeyLogWriter io.Writer
+
+	Tracer *Tracer
+
+	// ReadBufferSize, if positive, is the size of the read ahead buffer
+	// used by PreferGo connections to decode several small records from
+	// one read of the underlying connection.
+	ReadBufferSize int
+
+	// WriteBufferSize, if positive, makes PreferGo connections coalesce
+	// small writes into records of up to WriteBufferSize bytes (at most
+	// message.MaxPlaintextSize). Buffered data is sent when the buffer
+	// fills, WriteDelay after it was first buffered if WriteDelay is set,
+	// or by Conn.Flush, CloseWrite or Close.
+	WriteBufferSize int
+	WriteDelay      time.Duration
+
+	// SealWorkers, if greater than one, makes PreferGo connections seal
+	// writes spanning several records on up to SealWorkers goroutines, but
+	// no more than GOMAXPROCS. The workers start with the first such write,
+	// seal the next batch of records while the current one is written, and
+	// exit when the conn is closed. Records are written in order and match
+	// those of a single goroutine.
+	SealWorkers int
+
 	OptName uintptr
 
 	PreferGo bool
+
+	// precomputed caches the static-static DH result with PeerPublic for
+	// dialed conns, so a Config should not be copied while it is in use.
+	precomputed atomic.Value // *precomputed
 }
 
 func (c *Config) Control(network, adress string, conn syscall.RawConn) error {
@@ -48,6 +100,60 @@ func (c *Config) Control(network, adress string, conn syscall.RawConn) error {
 	return err
 }
 
+func (c *Config) Validate() error {
+	switch {
+	case c.StaticKey != nil:
+		if !c.PreferGo {
+			return ErrStaticKeyRequiresGo
+		}
+		if c.StaticPrivate != (noise.Key{}) && noise.PrivateKey(c.StaticPrivate).Public() != c.StaticKey.Public() {
+			return ErrKeyMismatch
+		}
+	case c.StaticPrivate == (noise.Key{}):
+		return ErrMissingStaticKey
+	}
+	if key, _ := c.staticKey(); c.StaticPublic != (noise.Key{}) && c.StaticPublic != key.Public() {
+		return ErrKeyMismatch
+	}
+	return nil
+}
+
+func (c *Config) staticPublic() noise.Key {
+	switch {
+	case c.StaticKey != nil:
+		return c.StaticKey.Public()
+	case c.StaticPublic == (noise.Key{}):
+		return noise.PrivateKey(c.StaticPrivate).Public()
+	default:
+		return c.StaticPublic
+	}
+}
+
+// staticKey returns the key used for static DH, and the copy of
+// StaticPrivate owned by the caller if the config has no StaticKey.
+func (c *Config) staticKey() (key StaticKey, owned *noise.PrivateKey) {
+	if c.StaticKey != nil {
+		return c.StaticKey, nil
+	}
+
+	priv := noise.PrivateKey(c.StaticPrivate)
+	return &priv, &priv
+}
+
+func (c *Config) rekeyAfter() time.Duration {
+	if c.RekeyAfter == 0 {
+		return DefaultRekeyAfter
+	}
+	return c.RekeyAfter
+}
+
+func (c *Config) rejectAfter() time.Duration {
+	if c.RejectAfter == 0 {
+		return DefaultRejectAfter
+	}
+	return c.RejectAfter
+}
+
 func (c *Config) Dialer() *net.Dialer {
 	return &net.Dialer{
 		Control: c.Control,
@@ -55,11 +161,17 @@ func (c *Config) Dialer() *net.Dialer {
 }
 
 func (c *Config) Listener(ln net.Listener) (net.Listener, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
 	if c.PreferGo {
-		return &listener{
+		cfg := *c
+		return &Listener{
 			Listener: ln,
 
-			config: *c,
+			config: &cfg,
+			conns:  make(map[*Conn]struct{}),
 		}, nil
 	}
 
@@ -79,6 +191,13 @@ func (c *Config) Listener(ln net.Listener) (net.Listener, error) {
 func Dial(ctx context.Context, network, addr string, config *Config) (net.Conn, error) {
 	switch network {
 	case "tcp", "tcp4", "tcp6":
+		if err := config.Validate(); err != nil {
+			return nil, err
+		}
+		if config.PeerPublic == (noise.Key{}) {
+			return nil, ErrMissingPeerKey
+		}
+
 		if config.PreferGo {
 			netConn, err := new(net.Dialer).DialContext(ctx, network, addr)
 			if err != nil {
@@ -86,7 +205,11 @@ func Dial(ctx context.Context, network, addr string, config *Config) (net.Conn,
 			}
 
 			conn := Client(netConn, config)
-			return conn, conn.sendHandshakeInitiation()
+			if err := conn.startHandshake(); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return conn, nil
 		}
 		return config.Dialer().DialContext(ctx, network, addr)
 	default:
@@ -97,6 +220,10 @@ func Dial(ctx context.Context, network, addr string, config *Config) (net.Conn,
 func Listen(ctx context.Context, network, addr string, config *Config) (net.Listener, error) {
 	switch network {
 	case "tcp", "tcp4", "tcp6":
+		if err := config.Validate(); err != nil {
+			return nil, err
+		}
+
 		ln, err := new(net.ListenConfig).Listen(ctx, network, addr)
 		if err != nil {
 			return nil, err
@@ -108,16 +235,59 @@ func Listen(ctx context.Context, network, addr string, config *Config) (net.List
 	}
 }
 
-type listener struct {
+type Listener struct {
 	net.Listener
 
-	config Config
+	mu     sync.Mutex
+	config *Config
+	conns  map[*Conn]struct{}
 }
 
-func (l *listener) Accept() (net.Conn, error) {
+func (l *Listener) Accept() (net.Conn, error) {
 	conn, err := l.Listener.Accept()
 	if err != nil {
 		return nil, err
 	}
-	return Server(conn, &l.config), nil
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sc := Server(conn, l.config)
+	sc.onClose = l.untrack
+	l.conns[sc] = struct{}{}
+	return sc, nil
+}
+
+// Reload atomically replaces the listener's config. Connections accepted
+// after Reload use the new config. Established connections whose peer is
+// missing from the new config's Peers are sent a revocation alert and
+// closed; connections still handshaking are checked once their handshake
+// completes.
+func (l *Listener) Reload(config *Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	cfg := *config
+
+	l.mu.Lock()
+	l.config = &cfg
+
+	conns := make([]*Conn, 0, len(l.conns))
+	for conn := range l.conns {
+		conns = append(conns, conn)
+	}
+	l.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.reload(cfg.Peers)
+	}
+	return nil
+}
+
+func (l *Listener) untrack(conn *Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.conns, conn)
 }
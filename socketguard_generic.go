@@ -7,3 +7,7 @@ import "syscall"
 func (c *Config) control(fd uintptr) error {
 	return syscall.ENOENT
 }
+
+func (c *Config) peerInfo(fd uintptr) (*PeerInfo, error) {
+	return nil, syscall.ENOENT
+}
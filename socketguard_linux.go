@@ -8,48 +8,69 @@ import (
 	"unsafe"
 
 	"golang.org/x/sys/unix"
-
-	"github.com/benburkert/socketguard-go/noise"
 )
 
-const optCryptoInfo = 1
+const (
+	optCryptoInfo = 1
+	optPeerInfo   = 2
+)
 
 var ulpName = []byte{'s', 'o', 'c', 'k', 'e', 't', 'g', 'u', 'a', 'r', 'd', 0}
 
+var (
+	setsockopt = rawSetsockopt
+	getsockopt = rawGetsockopt
+)
+
 func (c *Config) control(fd uintptr) error {
 	if c.OptName == 0 {
 		return errors.New("socketguard: OptName config required")
 	}
 
-	_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, fd, syscall.SOL_TCP,
-		unix.TCP_ULP, uintptr(unsafe.Pointer(&ulpName[0])), uintptr(len(ulpName)), 0)
-	if errno != 0 {
-		return errno
+	if err := setsockopt(fd, syscall.SOL_TCP, unix.TCP_ULP, ulpName); err != nil {
+		return err
+	}
+
+	info := c.cryptoInfo()
+	buf := info.pack(make([]byte, 0, cryptoInfoSizeV1))
+	defer zero(buf)
+
+	return setsockopt(fd, c.OptName, optCryptoInfo, buf)
+}
+
+func (c *Config) peerInfo(fd uintptr) (*PeerInfo, error) {
+	if c.OptName == 0 {
+		return nil, errors.New("socketguard: OptName config required")
 	}
 
-	info := cryptoInfo{
-		minVersion:    c.Version.Min(),
-		maxVersion:    c.Version.Max(),
-		staticPublic:  c.StaticPublic,
-		staticPrivate: c.StaticPrivate,
-		peerPublic:    c.PeerPublic,
-		presharedKey:  c.PresharedKey,
+	buf := make([]byte, peerInfoSizeV1)
+	n, err := getsockopt(fd, c.OptName, optPeerInfo, buf)
+	if err != nil {
+		return nil, err
 	}
 
-	_, _, errno = syscall.Syscall6(syscall.SYS_SETSOCKOPT, fd, c.OptName,
-		optCryptoInfo, uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info), 0)
+	info := new(PeerInfo)
+	if err := info.unpack(buf[:n]); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func rawSetsockopt(fd, level, opt uintptr, buf []byte) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, fd, level, opt,
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0)
 	if errno != 0 {
 		return errno
 	}
 	return nil
 }
 
-type cryptoInfo struct {
-	minVersion uint16
-	maxVersion uint16
-
-	staticPublic  [noise.KeySize]byte
-	staticPrivate [noise.KeySize]byte
-	peerPublic    [noise.KeySize]byte
-	presharedKey  [noise.KeySize]byte
+func rawGetsockopt(fd, level, opt uintptr, buf []byte) (int, error) {
+	size := uint32(len(buf))
+	_, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, level, opt,
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)), 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(size), nil
 }
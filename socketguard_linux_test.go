@@ -6,7 +6,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"reflect"
+	"syscall"
 	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/benburkert/socketguard-go/internal/must"
+	"github.com/benburkert/socketguard-go/noise"
 )
 
 const optName = 0x2C4 + 1
@@ -252,3 +259,120 @@ func TestNativeToGo(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestControl(t *testing.T) {
+	type sockopt struct {
+		fd, level, opt uintptr
+		buf            []byte
+	}
+
+	var calls []sockopt
+	defer func(fn func(fd, level, opt uintptr, buf []byte) error) { setsockopt = fn }(setsockopt)
+	setsockopt = func(fd, level, opt uintptr, buf []byte) error {
+		calls = append(calls, sockopt{fd, level, opt, append([]byte{}, buf...)})
+		return nil
+	}
+
+	if err := cliConf.Control("tcp", "", fakeRawConn(42)); err != nil {
+		t.Fatal(err)
+	}
+
+	info := cliConf.cryptoInfo()
+	want := []sockopt{
+		{42, syscall.SOL_TCP, unix.TCP_ULP, ulpName},
+		{42, optName, optCryptoInfo, info.pack(nil)},
+	}
+	if got := calls; !reflect.DeepEqual(want, got) {
+		t.Errorf("want setsockopt calls %x, got %x", want, got)
+	}
+}
+
+func TestPeerInfo(t *testing.T) {
+	version := noise.NewVersion(0, 1)
+
+	tests := []struct {
+		name string
+
+		buf []byte
+
+		info *PeerInfo
+		err  error
+	}{
+		{
+			name: "happy-path",
+
+			buf: must.Bytes(
+				uint16(peerInfoVersion1),
+				uint16(peerInfoSizeV1),
+				uint32(HandshakeFinished),
+				version[:],
+				srvPub[:],
+				uint64(3),
+				uint64(4),
+			),
+
+			info: &PeerInfo{
+				PeerPublic:     srvPub,
+				Version:        version,
+				State:          HandshakeFinished,
+				RekeysSent:     3,
+				RekeysReceived: 4,
+			},
+		},
+		{
+			name: "unknown-version",
+
+			buf: must.Bytes(
+				uint16(peerInfoVersion1+1),
+				uint16(peerInfoSizeV1),
+				make([]byte, peerInfoSizeV1-cryptoInfoHeaderSize),
+			),
+
+			err: ErrUnsupportedInfo,
+		},
+		{
+			name: "short-read",
+
+			buf: must.Bytes(
+				uint16(peerInfoVersion1),
+				uint16(peerInfoSizeV1),
+				uint32(HandshakeFinished),
+			),
+
+			err: ErrUnsupportedInfo,
+		},
+	}
+
+	defer func(fn func(fd, level, opt uintptr, buf []byte) (int, error)) { getsockopt = fn }(getsockopt)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			getsockopt = func(fd, level, opt uintptr, buf []byte) (int, error) {
+				if fd != 42 || level != optName || opt != optPeerInfo {
+					return 0, syscall.ENOPROTOOPT
+				}
+				return copy(buf, test.buf), nil
+			}
+
+			info, err := cliConf.PeerInfo(fakeRawConn(42))
+			if want, got := test.err, err; want != got {
+				t.Fatalf("want error %v, got %v", want, got)
+			}
+			if want, got := test.info, info; !reflect.DeepEqual(want, got) {
+				t.Errorf("want peer info %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+type fakeRawConn uintptr
+
+func (c fakeRawConn) SyscallConn() (syscall.RawConn, error) { return c, nil }
+
+func (c fakeRawConn) Control(fn func(fd uintptr)) error {
+	fn(uintptr(c))
+	return nil
+}
+
+func (c fakeRawConn) Read(fn func(fd uintptr) bool) error  { return syscall.EINVAL }
+func (c fakeRawConn) Write(fn func(fd uintptr) bool) error { return syscall.EINVAL }
@@ -0,0 +1,159 @@
+package socketguard
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benburkert/socketguard-go/internal/must"
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name string
+
+		config *Config
+
+		err error
+	}{
+		{
+			name: "happy-path",
+
+			config: &Config{
+				StaticPublic:  cliPub,
+				StaticPrivate: cliPriv,
+				PeerPublic:    srvPub,
+			},
+		},
+		{
+			name: "derived-public",
+
+			config: &Config{
+				StaticPrivate: cliPriv,
+				PeerPublic:    srvPub,
+			},
+		},
+		{
+			name: "go-server",
+
+			config: &Config{
+				StaticPrivate: srvPriv,
+				PreferGo:      true,
+			},
+		},
+		{
+			name: "zero-private",
+
+			config: &Config{
+				StaticPublic: cliPub,
+				PeerPublic:   srvPub,
+			},
+
+			err: ErrMissingStaticKey,
+		},
+		{
+			name: "mismatched-pair",
+
+			config: &Config{
+				StaticPublic:  srvPub,
+				StaticPrivate: cliPriv,
+				PeerPublic:    srvPub,
+			},
+
+			err: ErrKeyMismatch,
+		},
+		{
+			name: "kernel-server",
+
+			config: &Config{
+				StaticPublic:  cliPub,
+				StaticPrivate: cliPriv,
+			},
+		},
+		{
+			name: "static-key",
+
+			config: &Config{
+				StaticKey: noise.PrivateKey(srvPriv),
+				PreferGo:  true,
+			},
+		},
+		{
+			name: "static-key-kernel",
+
+			config: &Config{
+				StaticKey:  noise.PrivateKey(cliPriv),
+				PeerPublic: srvPub,
+			},
+
+			err: ErrStaticKeyRequiresGo,
+		},
+		{
+			name: "static-key-mismatch",
+
+			config: &Config{
+				StaticPublic: cliPub,
+				StaticKey:    noise.PrivateKey(srvPriv),
+				PreferGo:     true,
+			},
+
+			err: ErrKeyMismatch,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if want, got := test.err, test.config.Validate(); want != got {
+				t.Errorf("want error %v, got %v", want, got)
+			}
+		})
+	}
+
+	if want, got := cliPub, (&Config{StaticPrivate: cliPriv}).staticPublic(); want != got {
+		t.Errorf("want derived public key %x, got %x", want[:], got[:])
+	}
+
+	// only a dialer must know its peer up front
+	config := &Config{StaticPrivate: cliPriv}
+	if _, err := Dial(context.Background(), "tcp", "127.0.0.1:0", config); err != ErrMissingPeerKey {
+		t.Errorf("want dial error %v, got %v", ErrMissingPeerKey, err)
+	}
+}
+
+func TestDialHandshakeFailure(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var done []error
+	config := &Config{
+		StaticPrivate: cliPriv,
+		PeerPublic:    must.LowOrderPoints[1],
+		PreferGo:      true,
+		Tracer: &Tracer{
+			HandshakeDone: func(_ time.Duration, _ noise.Key, err error) {
+				done = append(done, err)
+			},
+		},
+	}
+
+	failures := TotalStats().HandshakeFailures["invalid_key"]
+
+	if _, err := Dial(context.Background(), "tcp", ln.Addr().String(), config); err != noise.ErrLowOrderPoint {
+		t.Fatalf("want dial error %v, got %v", noise.ErrLowOrderPoint, err)
+	}
+	if want, got := []error{noise.ErrLowOrderPoint}, done; !reflect.DeepEqual(want, got) {
+		t.Errorf("want handshake done with %v, got %v", want, got)
+	}
+	if want, got := failures+1, TotalStats().HandshakeFailures["invalid_key"]; want != got {
+		t.Errorf("want %d handshake failures, got %d", want, got)
+	}
+}
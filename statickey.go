@@ -0,0 +1,15 @@
+package socketguard
+
+import "github.com/benburkert/socketguard-go/noise"
+
+// StaticKey is a static private key. DH returns the X25519 shared secret of
+// the private key and a peer's public key, or noise.ErrLowOrderPoint.
+//
+// noise.PrivateKey is the in-memory implementation; the agent package
+// provides one backed by an sgagent process.
+type StaticKey interface {
+	Public() noise.Key
+	DH(peer noise.Key) (noise.Key, error)
+}
+
+var _ StaticKey = noise.PrivateKey{}
@@ -0,0 +1,159 @@
+package socketguard
+
+import (
+	"errors"
+	"expvar"
+	"io"
+	"net"
+	"sync/atomic"
+
+	"github.com/benburkert/socketguard-go/message"
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+type HandshakeFailureReason int
+
+const (
+	HandshakeFailureIO HandshakeFailureReason = iota
+	HandshakeFailureUnexpectedMessage
+	HandshakeFailureInvalidKey
+	HandshakeFailureUnknownPeer
+	HandshakeFailureOther
+
+	numHandshakeFailureReasons
+)
+
+func (r HandshakeFailureReason) String() string {
+	switch r {
+	case HandshakeFailureIO:
+		return "io"
+	case HandshakeFailureUnexpectedMessage:
+		return "unexpected_message"
+	case HandshakeFailureInvalidKey:
+		return "invalid_key"
+	case HandshakeFailureUnknownPeer:
+		return "unknown_peer"
+	default:
+		return "other"
+	}
+}
+
+type Stats struct {
+	BytesSent       uint64
+	BytesReceived   uint64
+	RecordsSent     uint64
+	RecordsReceived uint64
+
+	RekeysSent     uint64
+	RekeysReceived uint64
+
+	HandshakeFailures map[string]uint64
+	DecryptFailures   uint64
+}
+
+var totalStats stats
+
+func TotalStats() Stats {
+	return totalStats.snapshot()
+}
+
+func PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return TotalStats()
+	}))
+}
+
+func (c *Conn) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+type stats struct {
+	bytesSent       uint64
+	bytesReceived   uint64
+	recordsSent     uint64
+	recordsReceived uint64
+
+	rekeysSent     uint64
+	rekeysReceived uint64
+
+	handshakeFailures [numHandshakeFailureReasons]uint64
+	decryptFailures   uint64
+}
+
+func (s *stats) snapshot() Stats {
+	st := Stats{
+		BytesSent:       atomic.LoadUint64(&s.bytesSent),
+		BytesReceived:   atomic.LoadUint64(&s.bytesReceived),
+		RecordsSent:     atomic.LoadUint64(&s.recordsSent),
+		RecordsReceived: atomic.LoadUint64(&s.recordsReceived),
+
+		RekeysSent:     atomic.LoadUint64(&s.rekeysSent),
+		RekeysReceived: atomic.LoadUint64(&s.rekeysReceived),
+
+		HandshakeFailures: make(map[string]uint64, numHandshakeFailureReasons),
+		DecryptFailures:   atomic.LoadUint64(&s.decryptFailures),
+	}
+
+	for i := range s.handshakeFailures {
+		reason := HandshakeFailureReason(i)
+		st.HandshakeFailures[reason.String()] = atomic.LoadUint64(&s.handshakeFailures[i])
+	}
+	return st
+}
+
+func (c *Conn) countRecordSent(record int) {
+	for _, s := range []*stats{&c.stats, &totalStats} {
+		atomic.AddUint64(&s.recordsSent, 1)
+		atomic.AddUint64(&s.bytesSent, uint64(record))
+	}
+}
+
+func (c *Conn) countRecordReceived(record int) {
+	for _, s := range []*stats{&c.stats, &totalStats} {
+		atomic.AddUint64(&s.recordsReceived, 1)
+		atomic.AddUint64(&s.bytesReceived, uint64(record))
+	}
+}
+
+func (c *Conn) countRekeySent() {
+	atomic.AddUint64(&c.stats.rekeysSent, 1)
+	atomic.AddUint64(&totalStats.rekeysSent, 1)
+}
+
+func (c *Conn) countRekeyReceived() {
+	atomic.AddUint64(&c.stats.rekeysReceived, 1)
+	atomic.AddUint64(&totalStats.rekeysReceived, 1)
+}
+
+func (c *Conn) countDecryptFailure() {
+	atomic.AddUint64(&c.stats.decryptFailures, 1)
+	atomic.AddUint64(&totalStats.decryptFailures, 1)
+}
+
+func (c *Conn) countHandshakeFailure(err error) {
+	reason := handshakeFailureReason(err)
+	atomic.AddUint64(&c.stats.handshakeFailures[reason], 1)
+	atomic.AddUint64(&totalStats.handshakeFailures[reason], 1)
+}
+
+func handshakeFailureReason(err error) HandshakeFailureReason {
+	var (
+		ume UnexpectedMessageError
+		ute message.UnknownTypeError
+		ne  net.Error
+	)
+
+	switch {
+	case errors.As(err, &ume), errors.As(err, &ute):
+		return HandshakeFailureUnexpectedMessage
+	case errors.Is(err, noise.ErrLowOrderPoint):
+		return HandshakeFailureInvalidKey
+	case errors.Is(err, ErrUnknownPeer):
+		return HandshakeFailureUnknownPeer
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, io.ErrClosedPipe), errors.As(err, &ne):
+		return HandshakeFailureIO
+	default:
+		return HandshakeFailureOther
+	}
+}
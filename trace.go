@@ -0,0 +1,62 @@
+package socketguard
+
+import (
+	"time"
+
+	"github.com/benburkert/socketguard-go/noise"
+)
+
+type Tracer struct {
+	HandshakeStart func()
+	HandshakeDone  func(elapsed time.Duration, peer noise.Key, err error)
+
+	RekeySent     func()
+	RekeyReceived func()
+
+	DecryptFailure func(err error)
+
+	RecordSent     func(plaintext, record int)
+	RecordReceived func(plaintext, record int)
+}
+
+func (t *Tracer) handshakeStart() {
+	if t != nil && t.HandshakeStart != nil {
+		t.HandshakeStart()
+	}
+}
+
+func (t *Tracer) handshakeDone(elapsed time.Duration, peer noise.Key, err error) {
+	if t != nil && t.HandshakeDone != nil {
+		t.HandshakeDone(elapsed, peer, err)
+	}
+}
+
+func (t *Tracer) rekeySent() {
+	if t != nil && t.RekeySent != nil {
+		t.RekeySent()
+	}
+}
+
+func (t *Tracer) rekeyReceived() {
+	if t != nil && t.RekeyReceived != nil {
+		t.RekeyReceived()
+	}
+}
+
+func (t *Tracer) decryptFailure(err error) {
+	if t != nil && t.DecryptFailure != nil {
+		t.DecryptFailure(err)
+	}
+}
+
+func (t *Tracer) recordSent(plaintext, record int) {
+	if t != nil && t.RecordSent != nil {
+		t.RecordSent(plaintext, record)
+	}
+}
+
+func (t *Tracer) recordReceived(plaintext, record int) {
+	if t != nil && t.RecordReceived != nil {
+		t.RecordReceived(plaintext, record)
+	}
+}